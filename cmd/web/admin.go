@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"dyelesho/forum/internal/models"
+)
+
+// runAdmin handles the "admin grant|revoke <email>" subcommand. The user is
+// signed out everywhere, so that the new role only comes with a new session
+// token.
+func runAdmin(users models.UserStore, sessions models.SessionStore, args []string, infoLog *log.Logger) error {
+	if len(args) != 2 {
+		return errors.New("usage: admin grant|revoke <email>")
+	}
+
+	var role string
+	switch args[0] {
+	case "grant":
+		role = models.RoleAdmin
+	case "revoke":
+		role = models.RoleUser
+	default:
+		return fmt.Errorf("unknown admin command %q, want grant or revoke", args[0])
+	}
+
+	id, err := users.SetRole(args[1], role)
+	if errors.Is(err, models.ErrNoRecord) {
+		return fmt.Errorf("no user with email %q", args[1])
+	} else if err != nil {
+		return err
+	}
+	if err = sessions.DeleteSessionByUserId(id); err != nil {
+		return err
+	}
+	infoLog.Printf("User %s now has the %s role and has been signed out", args[1], role)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"dyelesho/forum/internal/models"
+	"dyelesho/forum/internal/models/memory"
+)
+
+// Changing a role must end every session of the user, so that the old role
+// cannot be used with a token issued before the change.
+func TestRunAdmin(t *testing.T) {
+	stores := memory.NewStores()
+	discard := log.New(io.Discard, "", 0)
+	for _, name := range []string{"alice", "bob"} {
+		if err := stores.Users.Insert(name, name+"@example.com", "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct{ command, role string }{
+		{"grant", models.RoleAdmin},
+		{"revoke", models.RoleUser},
+	} {
+		var sessions [2]models.Session
+		for i, userID := range []int{1, 2} {
+			sessions[i] = models.Session{UserID: userID}
+			if err := stores.Sessions.CreateSession(&sessions[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := runAdmin(stores.Users, stores.Sessions, []string{tt.command, "alice@example.com"}, discard); err != nil {
+			t.Fatalf("%s: %v", tt.command, err)
+		}
+		user, err := stores.Users.Get(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != tt.role {
+			t.Errorf("%s: role %q, want %q", tt.command, user.Role, tt.role)
+		}
+		if _, err = stores.Sessions.GetSessionFromToken(sessions[0].Token); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("%s: the session of alice is still valid, err = %v", tt.command, err)
+		}
+		if _, err = stores.Sessions.GetSessionFromToken(sessions[1].Token); err != nil {
+			t.Errorf("%s: the session of bob ended: %v", tt.command, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"grant"},
+		{"promote", "alice@example.com"},
+		{"grant", "nobody@example.com"},
+	} {
+		if err := runAdmin(stores.Users, stores.Sessions, args, discard); err == nil {
+			t.Errorf("admin %v: no error", args)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dyelesho/forum/internal/mail"
+	"dyelesho/forum/internal/models"
+	"dyelesho/forum/internal/scheduler"
+	"dyelesho/forum/internal/storage"
+)
+
+// digestSize is how many posts a digest lists.
+const digestSize = 5
+
+// defaultDigestInterval leaves the digest off: until mail is delivered for
+// real, the mail.Log mailer would write every address to the info log.
+const defaultDigestInterval time.Duration = 0
+
+// sessionCleanupJob removes the sessions that ran out. They are already
+// refused when they come back, so this only keeps the table small.
+func sessionCleanupJob(sessions models.SessionStore) scheduler.Job {
+	return scheduler.Job{
+		Name:     "sessions",
+		Interval: 15 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := sessions.DeleteExpiredSessions()
+			return fmt.Sprintf("removed %d expired sessions", n), err
+		},
+	}
+}
+
+// counterRepairJob recomputes the stored like, dislike and comment counts,
+// like the recount subcommand.
+func counterRepairJob(posts models.PostStore) scheduler.Job {
+	return scheduler.Job{
+		Name:     "counters",
+		Interval: 6 * time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := posts.RepairCounters()
+			return fmt.Sprintf("repaired the counters of %d posts and comments", n), err
+		},
+	}
+}
+
+// orphanCleanupJob deletes stored files that no attachment refers to. Files
+// are stored just before their attachment is recorded, so a file is only
+// deleted once it was already an orphan on the previous run.
+func orphanCleanupJob(attachments models.AttachmentStore, files storage.Store) scheduler.Job {
+	suspects := map[string]bool{}
+	return scheduler.Job{
+		Name:     "uploads",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			stored, err := files.List()
+			if err != nil {
+				return "", err
+			}
+			keys, err := attachments.Keys()
+			if err != nil {
+				return "", err
+			}
+
+			orphans := map[string]bool{}
+			deleted := 0
+			for _, key := range stored {
+				if keys[key] {
+					continue
+				}
+				if !suspects[key] {
+					orphans[key] = true
+					continue
+				}
+				if err = ctx.Err(); err != nil {
+					return fmt.Sprintf("deleted %d orphaned files", deleted), err
+				}
+				if err = files.Delete(key); err != nil {
+					return fmt.Sprintf("deleted %d orphaned files", deleted), err
+				}
+				deleted++
+			}
+			suspects = orphans
+			return fmt.Sprintf("deleted %d orphaned files, %d more to check on the next run", deleted, len(orphans)), nil
+		},
+	}
+}
+
+// digestJob mails every user the most liked posts of the past day, week or
+// month, whichever is closest to interval. Nothing is sent when no posts
+// were created in that time. baseURL is where the links point.
+func digestJob(posts models.PostStore, users models.UserStore, mailer mail.Mailer, baseURL string, interval time.Duration) scheduler.Job {
+	period := models.PeriodMonth
+	switch {
+	case interval <= 24*time.Hour:
+		period = models.PeriodDay
+	case interval <= 7*24*time.Hour:
+		period = models.PeriodWeek
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	return scheduler.Job{
+		Name:     "digest",
+		Interval: interval,
+		Run: func(ctx context.Context) (string, error) {
+			page, err := posts.Filter(models.PostFilter{Sort: models.SortTop, Period: period}, models.Pagination{Limit: digestSize})
+			if err != nil {
+				return "", err
+			}
+			if len(page.Posts) == 0 {
+				return "no new posts, nothing sent", nil
+			}
+
+			var body strings.Builder
+			fmt.Fprintf(&body, "The most liked posts of the past %s:\n\n", period)
+			for _, p := range page.Posts {
+				fmt.Fprintf(&body, "%s by %s, %d likes and %d comments\n%s/post/view/%d\n\n",
+					p.Title, p.UserName, p.Likes, p.CommentCount, baseURL, p.ID)
+			}
+
+			list, err := users.All()
+			if err != nil {
+				return "", err
+			}
+			sent := 0
+			for _, u := range list {
+				if err = ctx.Err(); err != nil {
+					return fmt.Sprintf("sent %d of %d digests", sent, len(list)), err
+				}
+				err = mailer.Send(mail.Message{
+					To:      u.Email,
+					Subject: "What's new on the forum",
+					Body:    "Hello " + u.Name + ",\n\n" + body.String(),
+				})
+				if err != nil {
+					return fmt.Sprintf("sent %d of %d digests", sent, len(list)), err
+				}
+				sent++
+			}
+			return fmt.Sprintf("sent %d digests", sent), nil
+		},
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"dyelesho/forum/internal/mail"
+	"dyelesho/forum/internal/models"
+	"dyelesho/forum/internal/models/memory"
+	"dyelesho/forum/internal/scheduler"
+	"dyelesho/forum/internal/storage"
+)
+
+// recorder is a mail.Mailer that keeps what it is given.
+type recorder struct {
+	sent []mail.Message
+}
+
+func (r *recorder) Send(m mail.Message) error {
+	r.sent = append(r.sent, m)
+	return nil
+}
+
+func TestDigestOffByDefault(t *testing.T) {
+	t.Setenv("FORUM_DIGEST_INTERVAL", "")
+	os.Unsetenv("FORUM_DIGEST_INTERVAL")
+	interval := envDuration("FORUM_DIGEST_INTERVAL", defaultDigestInterval)
+
+	var infoLog bytes.Buffer
+	jobs := scheduler.New(log.New(&infoLog, "", 0), log.New(io.Discard, "", 0))
+	stores := memory.NewStores()
+	jobs.Add(digestJob(stores.Posts, stores.Users, &recorder{}, "http://localhost", interval))
+
+	if list := jobs.Status(); len(list) != 0 {
+		t.Errorf("scheduled jobs = %+v, want the digest left out", list)
+	}
+	if !strings.Contains(infoLog.String(), "Job digest is disabled") {
+		t.Errorf("info log = %q", infoLog.String())
+	}
+
+	t.Setenv("FORUM_DIGEST_INTERVAL", "24h")
+	if d := envDuration("FORUM_DIGEST_INTERVAL", defaultDigestInterval); d != 24*time.Hour {
+		t.Errorf("FORUM_DIGEST_INTERVAL=24h gives %v", d)
+	}
+}
+
+func TestDigestJob(t *testing.T) {
+	stores := memory.NewStores()
+	mailer := &recorder{}
+	job := digestJob(stores.Posts, stores.Users, mailer, "http://forum.example/", 24*time.Hour)
+
+	report, err := job.Run(context.Background())
+	if err != nil || len(mailer.sent) != 0 {
+		t.Fatalf("without posts: %q, %v, %d mails", report, err, len(mailer.sent))
+	}
+
+	for _, name := range []string{"alice", "bob"} {
+		if err = stores.Users.Insert(name, name+"@example.com", "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, err := stores.Posts.Insert("Hiking in the Alps", "Long walks", []int{1}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = job.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != "sent 2 digests" || len(mailer.sent) != 2 {
+		t.Fatalf("report %q, %d mails", report, len(mailer.sent))
+	}
+	link := fmt.Sprintf("http://forum.example/post/view/%d", id)
+	for _, m := range mailer.sent {
+		if !strings.Contains(m.Body, "Hiking in the Alps") || !strings.Contains(m.Body, link) {
+			t.Errorf("mail to %s: %q", m.To, m.Body)
+		}
+	}
+
+	// A cancelled run stops before sending anything more.
+	mailer.sent = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = job.Run(ctx); err == nil || len(mailer.sent) != 0 {
+		t.Errorf("cancelled run: err = %v, %d mails", err, len(mailer.sent))
+	}
+}
+
+func TestSessionCleanupJob(t *testing.T) {
+	stores := memory.NewStores()
+	var sessions [2]models.Session
+	for i := range sessions {
+		sessions[i] = models.Session{UserID: 1}
+		if err := stores.Sessions.CreateSession(&sessions[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions[0].ExpirationDate = time.Now().Add(-time.Minute)
+	if err := stores.Sessions.RenewSession(&sessions[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := sessionCleanupJob(stores.Sessions).Run(context.Background())
+	if err != nil || report != "removed 1 expired sessions" {
+		t.Errorf("report %q, err %v", report, err)
+	}
+	if _, err = stores.Sessions.GetSessionFromToken(sessions[1].Token); err != nil {
+		t.Errorf("the live session was removed: %v", err)
+	}
+}
+
+func TestOrphanCleanupJob(t *testing.T) {
+	stores := memory.NewStores()
+	files := storage.NewMemory()
+	for _, key := range []string{"kept", "orphan"} {
+		if err := files.Put(key, strings.NewReader(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	postID, err := stores.Posts.Insert("Title", "Content", []int{1}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stores.Attachments.Insert(models.Attachment{PostID: postID, Name: "a.png", Key: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	job := orphanCleanupJob(stores.Attachments, files)
+
+	// An orphan is only deleted on the second run that finds it.
+	for run, want := range []string{"kept orphan", "kept"} {
+		if _, err := job.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := files.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(keys, " "); got != want {
+			t.Errorf("after run %d: files %q, want %q", run+1, got, want)
+		}
+	}
+}
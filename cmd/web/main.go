@@ -1,55 +1,164 @@
 package main
 
 import (
+	"context"
 	"dyelesho/forum/internal/dbs"
 	"dyelesho/forum/internal/handlers"
+	"dyelesho/forum/internal/mail"
 	"dyelesho/forum/internal/models"
+	"dyelesho/forum/internal/models/memory"
+	"dyelesho/forum/internal/scheduler"
+	"dyelesho/forum/internal/storage"
+	"errors"
 	"flag"
-	_ "github.com/mattn/go-sqlite3"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func main() {
-	addr := flag.String("addr", ":4000", "HTTP network address")
+	addr := flag.String("addr", envString("FORUM_ADDR", ":4000"), "HTTP network address")
+	tlsCert := flag.String("tls-cert", envString("FORUM_TLS_CERT", ""), "TLS certificate file, serves HTTPS together with -tls-key")
+	tlsKey := flag.String("tls-key", envString("FORUM_TLS_KEY", ""), "TLS private key file")
+	behindProxy := flag.Bool("behind-proxy", envBool("FORUM_BEHIND_PROXY", false), "Trust X-Forwarded-Proto and X-Forwarded-For from a reverse proxy")
+
+	dbCfg := dbs.DefaultConfig()
+	driver := flag.String("db-driver", envString("FORUM_DB_DRIVER", string(dbCfg.Driver)), "Database driver: sqlite3, postgres or memory")
+	flag.StringVar(&dbCfg.DSN, "db", envString("FORUM_DB", dbCfg.DSN), "SQLite database path or PostgreSQL connection string")
+	flag.BoolVar(&dbCfg.WAL, "db-wal", envBool("FORUM_DB_WAL", dbCfg.WAL), "Use the WAL journal mode")
+	flag.DurationVar(&dbCfg.BusyTimeout, "db-busy-timeout", envDuration("FORUM_DB_BUSY_TIMEOUT", dbCfg.BusyTimeout), "How long to wait for a locked database")
+	flag.BoolVar(&dbCfg.ForeignKeys, "db-foreign-keys", envBool("FORUM_DB_FOREIGN_KEYS", dbCfg.ForeignKeys), "Enforce foreign key constraints")
+	flag.IntVar(&dbCfg.MaxOpenConns, "db-max-open-conns", envInt("FORUM_DB_MAX_OPEN_CONNS", dbCfg.MaxOpenConns), "Maximum number of open database connections")
+	flag.IntVar(&dbCfg.MaxIdleConns, "db-max-idle-conns", envInt("FORUM_DB_MAX_IDLE_CONNS", dbCfg.MaxIdleConns), "Maximum number of idle database connections")
+	uploadDir := flag.String("upload-dir", envString("FORUM_UPLOAD_DIR", "./uploads"), "Directory where attachments are stored")
+	uploadMaxMB := flag.Int("upload-max-mb", envInt("FORUM_UPLOAD_MAX_MB", 5), "Largest attachment accepted, in megabytes")
+	uploadMaxFiles := flag.Int("upload-max-files", envInt("FORUM_UPLOAD_MAX_FILES", 4), "Most attachments accepted per post")
+	reactions := flag.String("reactions", envString("FORUM_REACTIONS", "like,dislike,heart,laugh,tada,thinking"), "Reactions users can pick, as known names or name=emoji")
+	commentDepth := flag.Int("comment-depth", envInt("FORUM_COMMENT_DEPTH", 5), "Deepest level at which comment replies are nested")
+	baseURL := flag.String("base-url", envString("FORUM_BASE_URL", ""), "Address of the forum used in links sent by mail (default http://localhost followed by -addr)")
+	digestInterval := flag.Duration("digest-interval", envDuration("FORUM_DIGEST_INTERVAL", defaultDigestInterval), "How often to mail the digest of popular posts, 0 (the default) to leave it off")
 	flag.Parse()
+	dbCfg.Driver = dbs.Dialect(*driver)
 
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	db, err := dbs.OpenDB()
+	reactionKinds, err := models.ParseReactionKinds(*reactions)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
-	dbs.CreatePosts(db)
-	dbs.CreateTables(db)
-	defer db.Close()
+	var stores models.Stores
+	var files storage.Store
+	if *driver == "memory" {
+		if flag.NArg() > 0 {
+			errorLog.Fatalf("%s needs a database, not the memory driver", flag.Arg(0))
+		}
+		infoLog.Println("Using the in-memory store, data will be lost on exit")
+		stores = memory.NewStores()
+		files = storage.NewMemory()
+	} else {
+		db, err := dbs.OpenDB(dbCfg)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		defer db.Close()
+
+		if flag.Arg(0) == "migrate" {
+			if err = runMigrate(db, flag.Args()[1:], infoLog); err != nil {
+				errorLog.Fatal(err)
+			}
+			return
+		}
+
+		if err = migrateUp(db, infoLog); err != nil {
+			errorLog.Fatal(err)
+		}
+		stores = models.NewStores(db)
+
+		if flag.Arg(0) == "admin" {
+			if err = runAdmin(stores.Users, stores.Sessions, flag.Args()[1:], infoLog); err != nil {
+				errorLog.Fatal(err)
+			}
+			return
+		}
+		if flag.Arg(0) == "recount" {
+			if err = runRecount(stores.Posts, flag.Args()[1:], infoLog); err != nil {
+				errorLog.Fatal(err)
+			}
+			return
+		}
+
+		disk, err := storage.NewDisk(*uploadDir)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		files = disk
+	}
+
 	templateCache, err := handlers.NewTemplateCache()
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
-	app := &handlers.Application{
-		ErrorLog:      errorLog,
-		InfoLog:       infoLog,
-		Posts:         &models.Model{DB: db},
-		TemplateCache: templateCache,
-		Users:         &models.UserModel{DB: db},
-		Reactions:     &models.ReactionModel{DB: db},
+	app := handlers.NewApplication(errorLog, infoLog, templateCache, stores)
+	app.MaxCommentDepth = *commentDepth
+	app.Files = files
+	app.MaxUploadSize = int64(*uploadMaxMB) << 20
+	app.MaxAttachments = *uploadMaxFiles
+	app.ReactionKinds = reactionKinds
+	app.BehindProxy = *behindProxy
+	if *baseURL == "" {
+		*baseURL = "http://localhost" + *addr
 	}
+
+	// The scheduler and the server both stop on Ctrl-C or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := scheduler.New(infoLog, errorLog)
+	jobs.Add(sessionCleanupJob(stores.Sessions))
+	jobs.Add(counterRepairJob(stores.Posts))
+	jobs.Add(orphanCleanupJob(stores.Attachments, files))
+	jobs.Add(digestJob(stores.Posts, stores.Users, &mail.Log{Logger: infoLog}, *baseURL, *digestInterval))
+	jobs.Start(ctx)
+	app.Jobs = jobs
+
 	srv := &http.Server{
 		Addr:         *addr,
 		ErrorLog:     errorLog,
 		Handler:      app.Routes(),
 		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
+		ReadTimeout:  30 * time.Second, // long enough to upload attachments
 		WriteTimeout: 10 * time.Second,
 	}
 
-	infoLog.Printf("Starting server on http://localhost%s", *addr)
-	err = srv.ListenAndServe()
-	errorLog.Fatal(err)
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		infoLog.Println("Shutting down")
+		// Give requests in progress a moment to finish.
+		timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(timeout)
+	}()
+
+	if *tlsCert != "" && *tlsKey != "" {
+		infoLog.Printf("Starting server on https://localhost%s", *addr)
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		infoLog.Printf("Starting server on http://localhost%s", *addr)
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		errorLog.Fatal(err)
+	}
+	if err = <-shutdown; err != nil {
+		errorLog.Println(err)
+	}
+	jobs.Wait()
+	infoLog.Println("Server stopped")
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"dyelesho/forum/internal/dbs"
+	"dyelesho/forum/internal/migrations"
+)
+
+func migrateUp(db *dbs.DB, infoLog *log.Logger) error {
+	m := &migrations.Migrator{DB: db, Migrations: migrations.For(db.Dialect)}
+	applied, err := m.Up()
+	for _, mig := range applied {
+		infoLog.Printf("Applied migration %d_%s", mig.Version, mig.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		infoLog.Println("Database schema is up to date")
+	}
+	return err
+}
+
+// runMigrate handles the "migrate up|down|status" subcommand.
+func runMigrate(db *dbs.DB, args []string, infoLog *log.Logger) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status")
+	}
+	m := &migrations.Migrator{DB: db, Migrations: migrations.For(db.Dialect)}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(db, infoLog)
+	case "down":
+		mig, err := m.Down()
+		if err != nil {
+			if errors.Is(err, migrations.ErrNoApplied) {
+				infoLog.Println("No applied migrations")
+				return nil
+			}
+			return err
+		}
+		infoLog.Printf("Rolled back migration %d_%s", mig.Version, mig.Name)
+		return nil
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			} else if s.NeedsFTS5 {
+				state = "pending, needs -tags sqlite_fts5"
+			}
+			fmt.Printf("%4d  %-40s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down or status", args[0])
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"dyelesho/forum/internal/models"
+)
+
+// runRecount handles the "recount" subcommand, which recomputes the like,
+// dislike and comment counters stored on posts and comments.
+func runRecount(posts models.PostStore, args []string, infoLog *log.Logger) error {
+	if len(args) != 0 {
+		return errors.New("usage: recount")
+	}
+	n, err := posts.RepairCounters()
+	if err != nil {
+		return err
+	}
+	infoLog.Printf("Repaired the counters of %d posts and comments", n)
+	return nil
+}
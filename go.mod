@@ -4,6 +4,9 @@ go 1.18
 
 require (
 	github.com/google/uuid v1.3.0
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.16
 	golang.org/x/crypto v0.9.0
 )
+
+require golang.org/x/net v0.10.0
@@ -2,92 +2,175 @@ package dbs
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func OpenDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "Forum.db")
+// Config describes where the database lives and how connections to it are
+// tuned. WAL, BusyTimeout and ForeignKeys only apply to SQLite.
+type Config struct {
+	Driver       Dialect
+	DSN          string
+	WAL          bool
+	BusyTimeout  time.Duration
+	ForeignKeys  bool
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Driver:       SQLite,
+		DSN:          "Forum.db",
+		WAL:          true,
+		BusyTimeout:  5 * time.Second,
+		ForeignKeys:  true,
+		MaxOpenConns: 10,
+		MaxIdleConns: 5,
+	}
+}
+
+func OpenDB(cfg Config) (*DB, error) {
+	switch cfg.Driver {
+	case SQLite:
+		return openSQLite(cfg)
+	case Postgres:
+		return openPostgres(cfg)
+	default:
+		return nil, fmt.Errorf("dbs: unsupported driver %q", cfg.Driver)
+	}
+}
+
+func openPostgres(cfg Config) (*DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+
 	if err = db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
-	return db, nil
+	return &DB{DB: db, Dialect: Postgres}, nil
 }
 
-func CreatePosts(db *sql.DB) error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS posts (
-			id INTEGER PRIMARY KEY,
-			title TEXT NOT NULL,
-			content TEXT NOT NULL,
-			created DATETIME NOT NULL,
-			category TEXT NOT NULL,
-			user_name TEXT NOT NULL
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_posts_created ON posts(created);`,
-	}
-	for _, stmt := range stmts {
-		_, err := db.Exec(stmt)
-		if err != nil {
-			return err
+func openSQLite(cfg Config) (*DB, error) {
+	path, memory := sqlitePath(cfg.DSN)
+	if !memory {
+		if err := checkWritable(path); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
-}
+	db, err := sql.Open("sqlite3", sqliteDSN(cfg))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
 
-func CreateTables(b *sql.DB) error {
-	var stmts []string = []string{Users, Comment, Session, PostReaction, CommentReaction}
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	for _, i := range stmts {
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-		_, err := b.Exec(i)
+	// Search uses FTS5 when go-sqlite3 was built with it, which it only is
+	// on request, and falls back to LIKE otherwise. A database that already
+	// has FTS5 tables cannot even be written to without it.
+	var fts5 bool
+	if err = db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if !fts5 {
+		var tables int
+		err = db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND sql LIKE 'CREATE VIRTUAL TABLE % USING fts5%'`).Scan(&tables)
 		if err != nil {
-			errorLog.Fatal(err)
-			return err
+			db.Close()
+			return nil, err
+		}
+		if tables > 0 {
+			db.Close()
+			return nil, errors.New("dbs: the database has FTS5 search tables but SQLite was built without FTS5, rebuild with -tags sqlite_fts5")
+		}
+	}
+
+	if cfg.WAL && !memory {
+		var mode string
+		if err = db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if !strings.EqualFold(mode, "wal") {
+			db.Close()
+			return nil, fmt.Errorf("dbs: could not enable WAL journal mode for %q (got %q)", path, mode)
 		}
 	}
-	return nil
+	return &DB{DB: db, Dialect: SQLite, FTS5: fts5}, nil
 }
 
-const (
-	Users = `CREATE TABLE IF NOT EXISTS Users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		email TEXT NOT NULL,
-		hashed_password CHAR(60) NOT NULL,
-		created DATETIME NOT NULL
-	);`
-
-	Comment = `CREATE TABLE IF NOT EXISTS comments (
-		"Id"	INTEGER PRIMARY KEY AUTOINCREMENT,
-		"CContent"	TEXT,
-		"Author"	TEXT,
-		"PostID" INTEGER
-	);`
-	Session = `CREATE TABLE IF NOT EXISTS Sessions (
-		session_id INTEGER PRIMARY KEY,
-		user_name TEXT,
-		user_id INTEGER,
-		token TEXT UNIQUE,
-		expiration_date TIMESTAMP
-	);`
-	PostReaction = `CREATE TABLE IF NOT EXISTS post_reactions (
-		user_id INTEGER,
-		post_id INTEGER,
-		like INTEGER,
-		dislike INTEGER
-	);`
-
-	CommentReaction = `CREATE TABLE IF NOT EXISTS comment_reactions (
-		user_id INTEGER,
-		comment_id INTEGER,
-		like INTEGER,
-		dislike INTEGER
-	);`
-)
+// sqliteDSN appends the connection pragmas from cfg to the configured DSN.
+func sqliteDSN(cfg Config) string {
+	params := url.Values{}
+	if cfg.WAL {
+		params.Set("_journal_mode", "WAL")
+	}
+	if cfg.BusyTimeout > 0 {
+		params.Set("_busy_timeout", fmt.Sprint(cfg.BusyTimeout.Milliseconds()))
+	}
+	// Every transaction here writes. Taking the write lock up front makes
+	// concurrent transactions wait for each other through the busy timeout
+	// instead of failing when a reader tries to upgrade its lock.
+	params.Set("_txlock", "immediate")
+	if cfg.ForeignKeys {
+		params.Set("_foreign_keys", "on")
+	} else {
+		params.Set("_foreign_keys", "off")
+	}
+
+	sep := "?"
+	if strings.Contains(cfg.DSN, "?") {
+		sep = "&"
+	}
+	return cfg.DSN + sep + params.Encode()
+}
+
+// sqlitePath extracts the file path from a plain path or "file:" URI DSN and
+// reports whether the DSN refers to an in-memory database.
+func sqlitePath(dsn string) (string, bool) {
+	path, query, _ := strings.Cut(dsn, "?")
+	path = strings.TrimPrefix(path, "file:")
+	if path == "" || path == ":memory:" || strings.Contains(query, "mode=memory") {
+		return path, true
+	}
+	return path, false
+}
+
+// checkWritable fails with a descriptive error when the database file (or
+// the directory it would be created in) cannot be written.
+func checkWritable(path string) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("dbs: database directory %q is not usable: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("dbs: database directory %q is not a directory", dir)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("dbs: database file %q is not writable: %w", path, err)
+	}
+	return f.Close()
+}
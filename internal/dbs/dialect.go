@@ -0,0 +1,99 @@
+package dbs
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour spoken by the underlying driver.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// DB wraps *sql.DB so that queries written with "?" placeholders run
+// unchanged on every supported dialect. FTS5 reports whether SQLite has the
+// FTS5 full-text search extension.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+	FTS5    bool
+}
+
+// Tx is the transactional counterpart of DB.
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+	FTS5    bool
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(Rebind(db.Dialect, query), args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(Rebind(db.Dialect, query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(Rebind(db.Dialect, query), args...)
+}
+
+func (db *DB) Prepare(query string) (*sql.Stmt, error) {
+	return db.DB.Prepare(Rebind(db.Dialect, query))
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: db.Dialect, FTS5: db.FTS5}, nil
+}
+
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(Rebind(tx.Dialect, query), args...)
+}
+
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(Rebind(tx.Dialect, query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(Rebind(tx.Dialect, query), args...)
+}
+
+// Rebind rewrites "?" placeholders into the numbered "$N" form used by
+// PostgreSQL. Question marks inside quoted strings or identifiers are left
+// alone. Queries for other dialects are returned unchanged.
+func Rebind(dialect Dialect, query string) string {
+	if dialect != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"dyelesho/forum/internal/imaging"
+	"dyelesho/forum/internal/models"
+	"dyelesho/forum/internal/storage"
+)
+
+const (
+	// thumbnailSize bounds both sides of a thumbnail, in pixels.
+	thumbnailSize = 240
+	// maxImagePixels keeps a small file that decodes to a huge image from
+	// exhausting memory when its thumbnail is made.
+	maxImagePixels = 40_000_000
+	// maxMultipartMemory is how much of a multipart form is held in memory
+	// before files spill over to temporary files.
+	maxMultipartMemory = 8 << 20
+)
+
+// allowedTypes maps the content types accepted for attachments to the file
+// extension they are stored with. The type is always sniffed from the file
+// contents; whatever the client claims is ignored.
+var allowedTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+// upload is an attachment that passed validation and is ready to store.
+type upload struct {
+	name        string
+	contentType string
+	data        []byte
+	thumb       []byte
+	thumbType   string
+}
+
+// readUploads validates the files of the "attachments" field, adding field
+// errors to form. JPEG files are stripped of their metadata and images get
+// a thumbnail.
+func (app *Application) readUploads(form *PostCreateForm, files []*multipart.FileHeader) ([]upload, error) {
+	if len(files) > app.MaxAttachments {
+		form.AddFieldError("attachments", fmt.Sprintf("At most %d files can be attached", app.MaxAttachments))
+		return nil, nil
+	}
+
+	var uploads []upload
+	for _, fh := range files {
+		name := cleanFileName(fh.Filename)
+		if fh.Size > app.MaxUploadSize {
+			form.AddFieldError("attachments", fmt.Sprintf("%s is larger than %s", name, formatSize(app.MaxUploadSize)))
+			continue
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(f, app.MaxUploadSize+1))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > app.MaxUploadSize {
+			form.AddFieldError("attachments", fmt.Sprintf("%s is larger than %s", name, formatSize(app.MaxUploadSize)))
+			continue
+		}
+		if len(data) == 0 {
+			form.AddFieldError("attachments", fmt.Sprintf("%s is empty", name))
+			continue
+		}
+
+		contentType := http.DetectContentType(data)
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if _, ok := allowedTypes[mediaType]; !ok {
+			form.AddFieldError("attachments", fmt.Sprintf("%s is not an image, a PDF or a text file", name))
+			continue
+		}
+		u := upload{name: name, contentType: contentType, data: data}
+
+		if strings.HasPrefix(mediaType, "image/") {
+			cfg, _, err := imaging.Config(data)
+			if err != nil {
+				form.AddFieldError("attachments", fmt.Sprintf("%s is not a valid image", name))
+				continue
+			}
+			if cfg.Width*cfg.Height > maxImagePixels {
+				form.AddFieldError("attachments", fmt.Sprintf("%s has too many pixels", name))
+				continue
+			}
+			if mediaType == "image/jpeg" {
+				if u.data, err = imaging.StripJPEGMetadata(data); err != nil {
+					form.AddFieldError("attachments", fmt.Sprintf("%s is not a valid image", name))
+					continue
+				}
+			}
+			var thumb bytes.Buffer
+			if u.thumbType, err = imaging.Thumbnail(&thumb, u.data, thumbnailSize); err != nil {
+				form.AddFieldError("attachments", fmt.Sprintf("%s is not a valid image", name))
+				continue
+			}
+			u.thumb = thumb.Bytes()
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, nil
+}
+
+// saveUploads stores the files and records them as attachments of a post.
+// A file whose record cannot be written is left behind as an orphan.
+func (app *Application) saveUploads(postID int, uploads []upload) error {
+	for _, u := range uploads {
+		mediaType, _, _ := mime.ParseMediaType(u.contentType)
+		key, err := storage.NewKey(allowedTypes[mediaType])
+		if err != nil {
+			return err
+		}
+		if err = app.Files.Put(key, bytes.NewReader(u.data)); err != nil {
+			return err
+		}
+
+		a := models.Attachment{
+			PostID:      postID,
+			Name:        u.name,
+			ContentType: u.contentType,
+			Size:        int64(len(u.data)),
+			Key:         key,
+		}
+		if u.thumb != nil {
+			if a.ThumbKey, err = storage.NewKey(allowedTypes[u.thumbType]); err != nil {
+				return err
+			}
+			if err = app.Files.Put(a.ThumbKey, bytes.NewReader(u.thumb)); err != nil {
+				return err
+			}
+		}
+		if _, err = app.Attachments.Insert(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFiles removes the stored files of attachments whose records are
+// gone. Failures are only logged: the files are orphans by now and can be
+// cleaned up later.
+func (app *Application) deleteFiles(attachments []models.Attachment) {
+	for _, a := range attachments {
+		for _, key := range []string{a.Key, a.ThumbKey} {
+			if key == "" {
+				continue
+			}
+			if err := app.Files.Delete(key); err != nil {
+				app.ErrorLog.Printf("deleting attachment file %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// AttachmentView serves an attachment, or its thumbnail under
+// /attachments/{id}/thumb. Only images are shown inline; everything else is
+// offered as a download so that the browser never renders it as a page.
+func (app *Application) AttachmentView(w http.ResponseWriter, r *http.Request) {
+	idStr, variant, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/attachments/"), "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id < 1 || variant != "" && variant != "thumb" {
+		app.NotFound(w, r)
+		return
+	}
+
+	a, err := app.Attachments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
+		}
+		return
+	}
+
+	key, contentType := a.Key, a.ContentType
+	if variant == "thumb" {
+		if a.ThumbKey == "" {
+			app.NotFound(w, r)
+			return
+		}
+		key, contentType = a.ThumbKey, mime.TypeByExtension(filepath.Ext(a.ThumbKey))
+	}
+
+	f, err := app.Files.Open(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
+		}
+		return
+	}
+	defer f.Close()
+
+	disposition := "attachment"
+	if a.IsImage() {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	// Files never change once uploaded.
+	w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+	if _, err = io.Copy(w, f); err != nil {
+		app.ErrorLog.Printf("serving attachment %d: %v", a.ID, err)
+	}
+}
+
+// cleanFileName keeps the base name of a client-supplied file name and
+// drops control characters, so that it is safe to show and to send back in
+// a Content-Disposition header.
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if utf8.RuneCountInString(name) > 100 {
+		name = string([]rune(name)[:100])
+	}
+	return name
+}
+
+// formatSize prints a byte count the way people read file sizes.
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " KB"
+	}
+	return strconv.FormatInt(n, 10) + " B"
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// setCookie sets a cookie with the attributes every cookie of the forum
+// shares: it is kept from scripts, sent for the whole site, withheld from
+// cross-site subrequests and, on HTTPS, never sent in the clear. A zero
+// expires makes it last until the browser closes.
+func (app *Application) setCookie(w http.ResponseWriter, r *http.Request, name, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   app.isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearCookie tells the browser to drop a cookie set by setCookie.
+func (app *Application) clearCookie(w http.ResponseWriter, r *http.Request, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   app.isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// isHTTPS reports whether the browser reached the forum over HTTPS, either
+// directly or, with BehindProxy set, through a proxy that terminates TLS.
+func (app *Application) isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return app.BehindProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// clientIP returns the address the request came from, without the port.
+// With BehindProxy set that is the last address in X-Forwarded-For, the one
+// the proxy appended; the ones before it are whatever the client claimed.
+func (app *Application) clientIP(r *http.Request) string {
+	if app.BehindProxy {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			forwarded := values[len(values)-1]
+			last := strings.TrimSpace(forwarded[strings.LastIndex(forwarded, ",")+1:])
+			if net.ParseIP(last) != nil {
+				return last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"dyelesho/forum/internal/models"
+)
+
+// checkCookie fails unless res sets the cookie name with the attributes
+// every cookie of the forum shares, and returns it.
+func checkCookie(t *testing.T, res testResponse, name string, secure bool) *http.Cookie {
+	t.Helper()
+	for _, c := range res.cookies {
+		if c.Name != name {
+			continue
+		}
+		if !c.HttpOnly {
+			t.Errorf("%s is not HttpOnly", name)
+		}
+		if c.Secure != secure {
+			t.Errorf("%s: Secure is %v, want %v", name, c.Secure, secure)
+		}
+		if c.SameSite != http.SameSiteLaxMode {
+			t.Errorf("%s: SameSite is %v, want Lax", name, c.SameSite)
+		}
+		if c.Path != "/" {
+			t.Errorf("%s: Path is %q, want /", name, c.Path)
+		}
+		return c
+	}
+	t.Fatalf("%s is not set", name)
+	return nil
+}
+
+func checkCleared(t *testing.T, res testResponse, name string, secure bool) {
+	t.Helper()
+	if c := checkCookie(t, res, name, secure); c.MaxAge >= 0 || c.Value != "" {
+		t.Errorf("%s is not cleared: %s", name, c)
+	}
+}
+
+func TestCookies(t *testing.T) {
+	for _, tls := range []bool{false, true} {
+		t.Run("tls="+strconv.FormatBool(tls), func(t *testing.T) {
+			app := newTestApplication(t)
+			var ts *testServer
+			if tls {
+				ts = newTLSTestServer(t, app.Routes())
+			} else {
+				ts = newTestServer(t, app.Routes())
+			}
+
+			// Anonymous visitors get a CSRF cookie.
+			checkCookie(t, ts.get(t, "/"), csrfCookie, tls)
+
+			// Sessions without "remember me" end with the browser.
+			res := ts.signup(t, "alice")
+			if c := checkCookie(t, res, sessionCookie, tls); !c.Expires.IsZero() {
+				t.Errorf("session cookie expires at %v, want a browser session", c.Expires)
+			}
+			checkCleared(t, ts.postForm(t, "/user/logout", url.Values{}), sessionCookie, tls)
+
+			res = ts.login(t, "alice", true)
+			if c := checkCookie(t, res, sessionCookie, tls); c.Expires.Before(time.Now().Add(24 * time.Hour)) {
+				t.Errorf("remembered session cookie expires at %v", c.Expires)
+			}
+
+			// A session close to its expiry is renewed along with its cookie.
+			sessions, err := app.Sessions.UserSessions(1)
+			if err != nil || len(sessions) != 1 {
+				t.Fatalf("sessions = %v, %v", sessions, err)
+			}
+			session := sessions[0]
+			session.ExpirationDate = time.Now().Add(time.Hour)
+			if err = app.Sessions.RenewSession(&session); err != nil {
+				t.Fatal(err)
+			}
+			if c := checkCookie(t, ts.get(t, "/"), sessionCookie, tls); c.Expires.Before(time.Now().Add(24 * time.Hour)) {
+				t.Errorf("renewed session cookie expires at %v", c.Expires)
+			}
+
+			// Revoking the current session signs the browser out.
+			res = ts.postForm(t, "/user/sessions/revoke", url.Values{"id": {strconv.Itoa(session.ID)}})
+			if res.status != http.StatusSeeOther {
+				t.Fatalf("revoke: status %d", res.status)
+			}
+			checkCleared(t, res, sessionCookie, tls)
+
+			// A cookie naming no session is cleared.
+			u, _ := url.Parse(ts.URL)
+			ts.Client().Jar.SetCookies(u, []*http.Cookie{{Name: sessionCookie, Value: "stale", Path: "/"}})
+			checkCleared(t, ts.get(t, "/"), sessionCookie, tls)
+		})
+	}
+}
+
+// Signing in with a session cookie already in the browser, whether planted
+// by someone else or left from an earlier sign in, must start a session
+// with a new token and end the old one.
+func TestLoginReplacesSession(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.Routes())
+	u, _ := url.Parse(ts.URL)
+
+	checkReplaced := func(old, res testResponse) {
+		t.Helper()
+		oldToken := checkCookie(t, old, sessionCookie, false).Value
+		newToken := checkCookie(t, res, sessionCookie, false).Value
+		if newToken == oldToken {
+			t.Fatal("the session token was kept")
+		}
+		if _, err := app.Sessions.GetSessionFromToken(oldToken); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("old session: err = %v, want ErrNoRecord", err)
+		}
+		if s, err := app.Sessions.GetSessionFromToken(newToken); err != nil || s.UserName != "alice" {
+			t.Errorf("new session = %+v, %v, want one for alice", s, err)
+		}
+
+		// A browser still holding the old token is signed out.
+		ts.Client().Jar.SetCookies(u, []*http.Cookie{{Name: sessionCookie, Value: oldToken, Path: "/"}})
+		checkCleared(t, ts.get(t, "/"), sessionCookie, false)
+		ts.Client().Jar.SetCookies(u, []*http.Cookie{{Name: sessionCookie, Value: newToken, Path: "/"}})
+	}
+
+	// A token planted by someone else.
+	planted := ts.signup(t, "mallory")
+	first := ts.signup(t, "alice")
+	checkReplaced(planted, first)
+
+	// The token of an earlier sign in.
+	checkReplaced(first, ts.login(t, "alice", false))
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name        string
+		behindProxy bool
+		forwarded   []string
+		want        string
+	}{
+		{"direct", false, nil, "192.0.2.1"},
+		{"forwarded header ignored", false, []string{"203.0.113.7"}, "192.0.2.1"},
+		{"proxy", true, []string{"203.0.113.7"}, "203.0.113.7"},
+		{"proxy without header", true, nil, "192.0.2.1"},
+		{"spoofed first entry", true, []string{"198.51.100.9, 203.0.113.7"}, "203.0.113.7"},
+		{"several headers", true, []string{"198.51.100.9", "203.0.113.7"}, "203.0.113.7"},
+		{"ipv6", true, []string{"198.51.100.9, 2001:db8::1"}, "2001:db8::1"},
+		{"garbage", true, []string{"203.0.113.7, nonsense"}, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &Application{BehindProxy: tt.behindProxy}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := app.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
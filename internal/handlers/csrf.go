@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+)
+
+// csrfCookie names the cookie that holds the CSRF secret of anonymous
+// visitors. Signed in users have their session token for that.
+const csrfCookie = "csrf_token"
+
+// Unsafe requests carry the CSRF token in the csrfField form field or, from
+// main.js, in the csrfHeader header.
+const (
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+const csrfContextKey = contextKey("csrf")
+
+// maxCSRFToken is more than any token deriveCSRFToken returns.
+const maxCSRFToken = 128
+
+// maxFormBytes bounds the URL-encoded bodies the CSRF middleware parses to
+// find the token. It is more than the longest post takes once encoded, and
+// far less than the 10MB net/http would otherwise read. Handlers only see
+// the parsed form, so their own smaller limits are checked on its values.
+const maxFormBytes = 1 << 20
+
+// deriveCSRFToken returns the token pages hand out for secret. It can be
+// shown in pages without giving the secret away.
+func deriveCSRFToken(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfToken returns the token the CSRF middleware issued for r.
+func (app *Application) csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey).(string)
+	return token
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// submittedCSRFToken returns the token sent with r. The header is looked at
+// first, so that requests from main.js are not parsed here at all.
+// Multipart bodies are left for the handler to parse with its own size
+// limit: only their first part is read, which is why forms list the token
+// first. Other bodies are parsed up to maxFormBytes.
+func submittedCSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if token := r.Header.Get(csrfHeader); token != "" {
+		return token, nil
+	}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return peekMultipartField(r, params["boundary"], csrfField), nil
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	return r.PostForm.Get(csrfField), nil
+}
+
+// peekMultipartField returns the value of the first part of the body of r if
+// it is the field name, and puts back what it read.
+func peekMultipartField(r *http.Request, boundary, name string) string {
+	var read bytes.Buffer
+	mr := multipart.NewReader(io.TeeReader(r.Body, &read), boundary)
+
+	var value []byte
+	if part, err := mr.NextPart(); err == nil && part.FormName() == name {
+		value, _ = io.ReadAll(io.LimitReader(part, maxCSRFToken))
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&read, r.Body), r.Body}
+	return string(value)
+}
+
+// csrfFailed answers a request whose CSRF token is missing or wrong. The
+// usual cause is a page left open across a sign in or out.
+func (app *Application) csrfFailed(w http.ResponseWriter, r *http.Request) {
+	app.InfoLog.Printf("Rejected %s %s: missing or invalid CSRF token", r.Method, r.URL.Path)
+	data := app.NewTemplateData(r)
+	data.ErrorStruct = &ErrorStruct{
+		Status:  http.StatusForbidden,
+		Text:    http.StatusText(http.StatusForbidden),
+		Message: "The form has expired. Reload the page and try again.",
+	}
+	app.renderErr(w, http.StatusForbidden, "error.html", data, r)
+}
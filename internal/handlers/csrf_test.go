@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.Routes())
+	ts.signup(t, "alice")
+	token := ts.csrfToken(t)
+
+	form := func(token string) (string, string) {
+		values := url.Values{"text": {"*hi*"}}
+		if token != "" {
+			values.Set(csrfField, token)
+		}
+		return "application/x-www-form-urlencoded", values.Encode()
+	}
+	multipartForm := func(token string) (string, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if token != "" {
+			mw.WriteField(csrfField, token)
+		}
+		mw.WriteField("text", "*hi*")
+		mw.Close()
+		return mw.FormDataContentType(), body.String()
+	}
+
+	tests := []struct {
+		name   string
+		body   func(token string) (string, string)
+		field  string
+		header string
+		status int
+	}{
+		{"form", form, token, "", http.StatusOK},
+		{"header", form, "", token, http.StatusOK},
+		{"multipart", multipartForm, token, "", http.StatusOK},
+		{"missing", form, "", "", http.StatusForbidden},
+		{"wrong", form, token + "x", "", http.StatusForbidden},
+		{"other visitor's", form, deriveCSRFToken("someone else"), "", http.StatusForbidden},
+		{"wrong header", form, "", "wrong", http.StatusForbidden},
+		// The header is checked first, a right form field does not help.
+		{"wrong header and right field", form, token, "wrong", http.StatusForbidden},
+		{"missing from multipart", multipartForm, "", "", http.StatusForbidden},
+		{"wrong in multipart", multipartForm, "wrong", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, body := tt.body(tt.field)
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/preview", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			if tt.header != "" {
+				req.Header.Set(csrfHeader, tt.header)
+			}
+			res := ts.do(t, req)
+			if res.status != tt.status {
+				t.Errorf("status %d, want %d", res.status, tt.status)
+			}
+			// Preview only reads URL-encoded forms.
+			if tt.status == http.StatusOK && !strings.HasPrefix(contentType, "multipart/") && !strings.Contains(res.body, "<em>hi</em>") {
+				t.Errorf("body %q", res.body)
+			}
+		})
+	}
+
+	// Anonymous visitors are checked as well, before they can sign in.
+	anonymous := newTestServer(t, app.Routes())
+	if res := anonymous.postForm(t, "/user/login", url.Values{}); res.status != http.StatusUnprocessableEntity {
+		t.Errorf("anonymous with token: status %d, want %d", res.status, http.StatusUnprocessableEntity)
+	}
+	req, _ := http.NewRequest(http.MethodPost, anonymous.URL+"/user/login", strings.NewReader("email=a&password=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res := anonymous.do(t, req); res.status != http.StatusForbidden {
+		t.Errorf("anonymous without token: status %d, want %d", res.status, http.StatusForbidden)
+	}
+}
+
+func TestCSRFBodyLimit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.Routes())
+	ts.signup(t, "alice")
+	token := ts.csrfToken(t)
+
+	// The token is never looked for past maxFormBytes.
+	body := "text=" + strings.Repeat("a", maxFormBytes) + "&" + csrfField + "=" + token
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/preview", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res := ts.do(t, req); res.status != http.StatusBadRequest {
+		t.Errorf("oversized form: status %d, want %d", res.status, http.StatusBadRequest)
+	}
+
+	// Handlers still apply their own limits to forms the middleware parsed.
+	res := ts.postForm(t, "/preview", url.Values{"text": {strings.Repeat("a", maxPreviewBytes+1)}})
+	if res.status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized preview: status %d, want %d", res.status, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -3,34 +3,68 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
-	"unicode/utf8"
 
+	"dyelesho/forum/internal/markdown"
 	"dyelesho/forum/internal/models"
+	"dyelesho/forum/internal/scheduler"
+	"dyelesho/forum/internal/storage"
 	"dyelesho/forum/internal/validator"
 )
 
 type Application struct {
-	ErrorLog      *log.Logger
-	InfoLog       *log.Logger
-	Posts         *models.Model
-	TemplateCache map[string]*template.Template
-	Users         *models.UserModel
-	categories    []string
-	Reactions     *models.ReactionModel
-}
-
-type CategoriesForm struct {
-	Technology    string
-	Entertainment string
-	Travel        string
-	Health        string
-	validator.Validator
+	ErrorLog        *log.Logger
+	InfoLog         *log.Logger
+	Posts           models.PostStore
+	Categories      models.CategoryStore
+	Search          models.SearchStore
+	Attachments     models.AttachmentStore
+	Files           storage.Store
+	Comments        models.CommentStore
+	TemplateCache   map[string]*template.Template
+	Users           models.UserStore
+	Sessions        models.SessionStore
+	Reactions       models.ReactionStore
+	MaxCommentDepth int
+	MaxUploadSize   int64
+	MaxAttachments  int
+	ReactionKinds   []models.ReactionKind
+	// BehindProxy trusts the X-Forwarded-Proto and X-Forwarded-For headers
+	// set by a reverse proxy in front of the forum.
+	BehindProxy bool
+	// Jobs runs the housekeeping jobs shown on the admin jobs page. It may
+	// be nil.
+	Jobs *scheduler.Scheduler
+}
+
+// NewApplication wires an Application to the given stores. Any set of
+// stores will do, which lets tests run the handlers against package memory.
+// Uploaded files are kept in memory until Files is set to another store.
+func NewApplication(errorLog, infoLog *log.Logger, templateCache map[string]*template.Template, stores models.Stores) *Application {
+	return &Application{
+		ErrorLog:        errorLog,
+		InfoLog:         infoLog,
+		Posts:           stores.Posts,
+		Categories:      stores.Categories,
+		Search:          stores.Search,
+		Attachments:     stores.Attachments,
+		Files:           storage.NewMemory(),
+		Comments:        stores.Comments,
+		TemplateCache:   templateCache,
+		Users:           stores.Users,
+		Sessions:        stores.Sessions,
+		Reactions:       stores.Reactions,
+		MaxCommentDepth: 5,
+		MaxUploadSize:   5 << 20,
+		MaxAttachments:  4,
+		ReactionKinds:   models.ReactionKinds,
+	}
 }
 
 type CommentCreateForm struct {
@@ -39,16 +73,30 @@ type CommentCreateForm struct {
 }
 
 type PostCreateForm struct {
-	Title      string
-	Content    string
-	Category   string
-	Categories []string
+	Title       string
+	Content     string
+	CategoryIDs []int
+	validator.Validator
+}
+
+type CategoryForm struct {
+	Name string
+	validator.Validator
+}
+
+type SearchForm struct {
+	Query    string
+	Author   string
+	Category string
+	From     string
+	To       string
 	validator.Validator
 }
 
 type ErrorStruct struct {
-	Status int
-	Text   string
+	Status  int
+	Text    string
+	Message string
 }
 
 type UserSignupForm struct {
@@ -61,111 +109,215 @@ type UserSignupForm struct {
 type UserLoginForm struct {
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	Remember            bool   `form:"remember"`
 	validator.Validator `form:"-"`
 }
 
+// Home lists posts, newest first unless asked otherwise. The listing is
+// narrowed and ordered by GET parameters so that every view can be
+// bookmarked:
+//
+//	cat     category name, may be repeated
+//	match   "all" to require every cat, otherwise any of them will do
+//	filter  "created" or "liked" for the signed in user's posts
+//	sort    "new", "hot", "top" or "comments"
+//	period  "day", "week", "month" or "all" to only list recent posts
+//	after   cursor of the last post on the previous page
+//	before  cursor of the first post on the next page
 func (app *Application) Home(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		app.NotFound(w, r)
 		return
 	}
-	switch r.Method {
-	case http.MethodGet:
-		category := r.URL.Query().Get("category")
 
-		session, err := app.CheckSession(w, r)
-		if err != nil {
-			app.ServerError(w, err, r)
+	query := r.URL.Query()
+	filter := models.PostFilter{
+		Categories: query["cat"],
+		MatchAll:   query.Get("match") == "all",
+		Sort:       models.PostSort(query.Get("sort")),
+		Period:     models.Period(query.Get("period")),
+	}
+	switch filter.Sort {
+	case "", models.SortNew, models.SortHot, models.SortTop, models.SortComments:
+	default:
+		app.ClientError(w, r)
+		return
+	}
+	switch filter.Period {
+	case "", models.PeriodDay, models.PeriodWeek, models.PeriodMonth, models.PeriodAll:
+	default:
+		app.ClientError(w, r)
+		return
+	}
+
+	after, err := queryCursor(query, "after")
+	if err != nil {
+		app.ClientError(w, r)
+		return
+	}
+	before, err := queryCursor(query, "before")
+	if err != nil {
+		app.ClientError(w, r)
+		return
+	}
+	// A cursor from one kind of listing means nothing in the other.
+	for _, c := range []*models.Cursor{after, before} {
+		if c != nil && c.Ranked() != filter.Sort.Ranked() {
+			app.ClientError(w, r)
 			return
 		}
+	}
+	pagination := models.Pagination{After: after, Before: before}
 
-		var posts []*models.Post
-
-		switch category {
-		case "created":
-			if session == nil {
-				http.Redirect(w, r, "/login", http.StatusSeeOther)
-				return
-			}
-			posts, err = app.Posts.GetPostsByUser(session.UserName)
-
-		case "liked":
-			if session == nil {
-				http.Redirect(w, r, "/login", http.StatusSeeOther)
-				return
-			}
-			posts, err = app.Posts.GetPostsByUserReaction(session.UserID)
-
-		case "latest":
-			posts, err = app.Posts.Latest()
-
-		default:
-			posts, err = app.Posts.Latest()
-		}
+	session := app.session(r)
 
-		if err != nil {
-			app.ServerError(w, err, r)
+	show := query.Get("filter")
+	switch show {
+	case "created", "liked":
+		if session == nil {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
+		if show == "created" {
+			filter.Author = session.UserName
+		} else {
+			filter.LikedBy = session.UserID
+		}
+	case "":
+	default:
+		app.ClientError(w, r)
+		return
+	}
 
-		data := app.NewTemplateData(r)
-		data.Posts = posts
-		data.IsAuthenticated = session != nil
+	page, err := app.Posts.Filter(filter, pagination)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
 
-		app.Render(w, http.StatusOK, "home.html", data, r)
-	case http.MethodPost:
-		session, err := app.CheckSession(w, r)
-		if err != nil {
-			app.ServerError(w, err, r)
-			return
-		}
+	categories, err := app.Categories.All()
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
 
-		var posts []*models.Post
-		r.ParseForm()
+	data := app.NewTemplateData(r)
+	data.Posts = page.Posts
+	data.Categories = categories
+	data.Filter = filter
+	data.Show = show
+	data.Total = page.Total
+	if page.Prev != nil {
+		data.PrevURL = pageURL(query, "before", page.Prev)
+	}
+	if page.Next != nil {
+		data.NextURL = pageURL(query, "after", page.Next)
+	}
+	data.IsAuthenticated = session != nil
 
-		form := &CategoriesForm{
-			Technology:    r.FormValue("Technology"),
-			Entertainment: r.FormValue("Entertainment"),
-			Travel:        r.FormValue("Travel"),
-			Health:        r.FormValue("Health"),
-		}
+	app.Render(w, http.StatusOK, "home.html", data, r)
+}
 
-		posts, err = app.Posts.Latest()
-		if err != nil {
-			app.ServerError(w, err, r)
-			return
-		}
+// queryCursor decodes the cursor in query[key], if there is one.
+func queryCursor(query url.Values, key string) (*models.Cursor, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	c, err := models.DecodeCursor(value)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
 
-		var filteredPosts []*models.Post
-
-		for i := range posts {
-			switch {
-			case form.Technology != "" && posts[i].Category != "" && strings.Contains(posts[i].Category, form.Technology):
-				filteredPosts = append(filteredPosts, posts[i])
-			case form.Travel != "" && posts[i].Category != "" && strings.Contains(posts[i].Category, form.Travel):
-				filteredPosts = append(filteredPosts, posts[i])
-			case form.Health != "" && posts[i].Category != "" && strings.Contains(posts[i].Category, form.Health):
-				filteredPosts = append(filteredPosts, posts[i])
-			case form.Entertainment != "" && posts[i].Category != "" && strings.Contains(posts[i].Category, form.Entertainment):
-				filteredPosts = append(filteredPosts, posts[i])
-			}
-		}
+// pageURL returns the home page URL for query with the cursor replaced.
+// key is "after" or "before".
+func pageURL(query url.Values, key string, cursor *models.Cursor) string {
+	q := url.Values{}
+	for k, values := range query {
+		q[k] = values
+	}
+	q.Del("after")
+	q.Del("before")
+	q.Set(key, cursor.Encode())
+	return "/?" + q.Encode()
+}
 
-		if filteredPosts == nil {
-			data := app.NewTemplateData(r)
-			data.Posts = []*models.Post{} 
-			data.IsAuthenticated = session != nil
+// SearchView runs a full-text search over posts and comments. Besides q it
+// takes the optional author, cat, from and to (YYYY-MM-DD, inclusive) and
+// page parameters.
+func (app *Application) SearchView(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	form := SearchForm{
+		Query:    strings.TrimSpace(query.Get("q")),
+		Author:   strings.ToLower(strings.TrimSpace(query.Get("author"))),
+		Category: query.Get("cat"),
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+	}
+	q := models.SearchQuery{Text: form.Query, Author: form.Author, Category: form.Category, Page: 1}
 
-			app.Render(w, http.StatusOK, "home.html", data, r)
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			app.NotFound(w, r)
 			return
 		}
+		q.Page = page
+	}
+	if form.From != "" {
+		from, err := time.Parse("2006-01-02", form.From)
+		form.CheckField(err == nil, "from", "Use the YYYY-MM-DD format")
+		q.From = from
+	}
+	if form.To != "" {
+		to, err := time.Parse("2006-01-02", form.To)
+		form.CheckField(err == nil, "to", "Use the YYYY-MM-DD format")
+		q.To = to.AddDate(0, 0, 1)
+	}
 
-		data := app.NewTemplateData(r)
-		data.Posts = filteredPosts
-		data.IsAuthenticated = session != nil
+	categories, err := app.Categories.All()
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+
+	data := app.NewTemplateData(r)
+	data.Form = form
+	data.Categories = categories
+	if !form.Valid() {
+		app.Render(w, http.StatusUnprocessableEntity, "search.html", data, r)
+		return
+	}
+
+	page, err := app.Search.Search(q)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	data.Results = page.Results
+	if page.HasPrev {
+		data.PrevURL = searchURL(query, page.Page-1)
+	}
+	if page.HasNext {
+		data.NextURL = searchURL(query, page.Page+1)
+	}
+	app.Render(w, http.StatusOK, "search.html", data, r)
+}
 
-		app.Render(w, http.StatusOK, "home.html", data, r)
+// searchURL returns the search URL for query with the page replaced.
+func searchURL(query url.Values, page int) string {
+	q := url.Values{}
+	for k, values := range query {
+		q[k] = values
+	}
+	if page > 1 {
+		q.Set("page", strconv.Itoa(page))
+	} else {
+		q.Del("page")
 	}
+	return "/search?" + q.Encode()
 }
 
 func (app *Application) PostView(w http.ResponseWriter, r *http.Request) {
@@ -176,6 +328,8 @@ func (app *Application) PostView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	session := app.session(r)
+
 	post, err := app.Posts.Get(id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
@@ -186,13 +340,39 @@ func (app *Application) PostView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := app.CheckSession(w, r)
+	app.renderPost(w, r, post, session, http.StatusOK, false)
+}
+
+// viewerID returns the id of the signed in user, or 0 for anonymous visitors.
+func viewerID(session *models.Session) int {
+	if session == nil {
+		return 0
+	}
+	return session.UserID
+}
+
+// renderPost renders view.html for a post together with its comment tree and
+// edit history. commentError flags a rejected comment submission.
+func (app *Application) renderPost(w http.ResponseWriter, r *http.Request, post *models.Post, session *models.Session, status int, commentError bool) {
+	reactions, err := app.Reactions.PostReactions(viewerID(session), post.ID)
 	if err != nil {
 		app.ServerError(w, err, r)
 		return
 	}
 
-	comments, err := app.Posts.GetComments(post.ID)
+	comments, err := app.Comments.GetCommentTree(post.ID, app.MaxCommentDepth, viewerID(session))
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+
+	revisions, err := app.Posts.GetRevisions(post.ID)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+
+	attachments, err := app.Attachments.ForPost(post.ID)
 	if err != nil {
 		app.ServerError(w, err, r)
 		return
@@ -200,16 +380,30 @@ func (app *Application) PostView(w http.ResponseWriter, r *http.Request) {
 
 	data := app.NewTemplateData(r)
 	data.Post = post
+	data.Attachments = attachments
 	data.Comments = comments
+	data.History = postHistory(post, revisions)
+	data.IsAuthor = session != nil && session.UserName == post.UserName
+	data.CommentError = commentError
+	post.Reactions = reactions.Counts
+	post.ViewerReaction = reactions.Viewer
+	post.ReactionList = models.CountReactions(app.ReactionKinds, post.Reactions)
+	app.listReactions(data.Comments)
 
 	if session != nil {
 		data.Post.IsAuthenticated = true
-		for i := range data.Comments {
-			data.Comments[i].IsAuthenticated = true
-		}
+		markComments(data.Comments, session.UserName)
 	}
 
-	app.Render(w, http.StatusOK, "view.html", data, r)
+	app.Render(w, status, "view.html", data, r)
+}
+
+func markComments(comments []*models.Comment, userName string) {
+	for _, c := range comments {
+		c.IsAuthenticated = true
+		c.IsAuthor = c.Author == userName
+		markComments(c.Replies, userName)
+	}
 }
 
 func (app *Application) CreateComment(w http.ResponseWriter, r *http.Request) {
@@ -220,45 +414,43 @@ func (app *Application) CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment := r.FormValue("comment")
+	session := app.session(r)
+	if session == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 
-	if comment == "" || strings.TrimSpace(comment) == "" || utf8.RuneCountInString(comment) > 300 || countLines(comment) > 15 {
-		post, err := app.Posts.Get(id)
-		if err != nil {
-			if errors.Is(err, models.ErrNoRecord) {
-				app.NotFound(w, r)
-			} else {
-				app.ServerError(w, err, r)
-			}
-			return
+	post, err := app.Posts.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
 		}
+		return
+	}
 
-		comments, err := app.Posts.GetComments(post.ID)
-		if err != nil {
+	var parentID int
+	if v := r.FormValue("parent_id"); v != "" {
+		parentID, err = strconv.Atoi(v)
+		if err != nil || parentID < 1 {
+			app.ClientError(w, r)
+			return
+		}
+		parent, err := app.Comments.GetComment(parentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
 			app.ServerError(w, err, r)
 			return
 		}
-
-		data := &TemplateData{
-			CurrentYear:     time.Now().Year(),
-			Post:            post,
-			IsAuthenticated: true,
-			Comments:        comments,
-			CommentError:    true,
+		if err != nil || parent.PostID != post.ID || parent.Deleted {
+			app.ClientError(w, r)
+			return
 		}
-
-		app.Render(w, http.StatusOK, "view.html", data, r)
-		return
 	}
 
-	comment = strings.Replace(comment, "\n", "<br>", -1)
-	session, err := app.CheckSession(w, r)
-	if err != nil {
-		app.ServerError(w, err, r)
-		return
-	}
-	if session == nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	comment := r.FormValue("comment")
+	if !validComment(comment) {
+		app.renderPost(w, r, post, session, http.StatusOK, true)
 		return
 	}
 
@@ -266,9 +458,10 @@ func (app *Application) CreateComment(w http.ResponseWriter, r *http.Request) {
 		Author:   session.UserName,
 		CContent: comment,
 		PostID:   id,
+		ParentID: parentID,
 	}
 
-	err = app.Posts.PostComment(commentInput)
+	err = app.Comments.PostComment(commentInput)
 	if err != nil {
 		app.ServerError(w, err, r)
 		return
@@ -282,78 +475,340 @@ func countLines(comment string) int {
 	return len(lines)
 }
 
+// maxCommentChars and maxPostChars bound what users can write, which also
+// bounds the work of rendering it on every page view.
+const (
+	maxCommentChars = 300
+	maxPostChars    = 20000
+)
+
+func validComment(comment string) bool {
+	return validator.NotBlank(comment) && validator.MaxChars(comment, maxCommentChars) && countLines(comment) <= 15
+}
+
+// authorComment loads the live comment whose id follows prefix in the URL and
+// checks that the current user wrote it. On failure it writes the response
+// itself and returns nil.
+func (app *Application) authorComment(w http.ResponseWriter, r *http.Request, prefix string) *models.Comment {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return nil
+	}
+
+	comment, err := app.Comments.GetComment(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
+		}
+		return nil
+	}
+	if comment.Deleted {
+		app.NotFound(w, r)
+		return nil
+	}
+
+	session := app.session(r)
+	if session == nil {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return nil
+	}
+	if comment.Author != session.UserName {
+		app.Forbidden(w, r)
+		return nil
+	}
+	return comment
+}
+
+func (app *Application) CommentEdit(w http.ResponseWriter, r *http.Request) {
+	comment := app.authorComment(w, r, "/comment/edit/")
+	if comment == nil {
+		return
+	}
+
+	data := app.NewTemplateData(r)
+	data.Comment = comment
+	data.Form = CommentCreateForm{CContent: comment.CContent}
+	app.Render(w, http.StatusOK, "comment.html", data, r)
+}
+
+func (app *Application) CommentEditPost(w http.ResponseWriter, r *http.Request) {
+	comment := app.authorComment(w, r, "/comment/edit/")
+	if comment == nil {
+		return
+	}
+
+	form := CommentCreateForm{CContent: r.FormValue("comment")}
+	form.CheckField(validComment(form.CContent), "comment", "Please enter a valid comment.")
+	if !form.Valid() {
+		data := app.NewTemplateData(r)
+		data.Comment = comment
+		data.Form = form
+		app.Render(w, http.StatusUnprocessableEntity, "comment.html", data, r)
+		return
+	}
+
+	err := app.Comments.UpdateComment(comment.Id, form.CContent)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/post/view/%d", comment.PostID), http.StatusSeeOther)
+}
+
+func (app *Application) CommentDelete(w http.ResponseWriter, r *http.Request) {
+	comment := app.authorComment(w, r, "/comment/delete/")
+	if comment == nil {
+		return
+	}
+
+	err := app.Comments.DeleteComment(comment.Id)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/post/view/%d", comment.PostID), http.StatusSeeOther)
+}
+
+// maxPreviewBytes bounds the text the preview endpoint will render.
+const maxPreviewBytes = 64 << 10
+
+// Preview renders the "text" form field as Markdown and returns the HTML
+// fragment. The create, edit and comment forms use it from main.js.
+func (app *Application) Preview(w http.ResponseWriter, r *http.Request) {
+	// The CSRF middleware has parsed the body already unless the token came
+	// in a header, so the limit is checked on the text as well.
+	r.Body = http.MaxBytesReader(w, r.Body, maxPreviewBytes)
+	err := r.ParseForm()
+	if err != nil {
+		app.ClientError(w, r)
+		return
+	}
+	text := r.PostForm.Get("text")
+	if len(text) > maxPreviewBytes {
+		app.ErrorHandler(w, http.StatusRequestEntityTooLarge, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(markdown.Render(text)))
+}
+
 func (app *Application) PostCreate(w http.ResponseWriter, r *http.Request) {
+	categories, err := app.Categories.All()
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+
 	data := app.NewTemplateData(r)
-	data.Categories = app.categories
+	data.Categories = categories
 	data.Form = PostCreateForm{}
 	app.Render(w, http.StatusOK, "create.html", data, r)
 }
 
 func (app *Application) PostCreatePost(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
+	// Leave room for the text fields next to the largest allowed files.
+	limit := int64(app.MaxAttachments)*app.MaxUploadSize + 1<<20
+	if r.ContentLength > limit {
+		app.ErrorHandler(w, http.StatusRequestEntityTooLarge, r)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	err := r.ParseMultipartForm(maxMultipartMemory)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
 		app.ClientError(w, r)
 		return
 	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
 
-	catForm := &CategoriesForm{
-		Technology:    r.FormValue("Technology"),
-		Entertainment: r.FormValue("Entertainment"),
-		Travel:        r.FormValue("Travel"),
-		Health:        r.FormValue("Health"),
+	categories, err := app.Categories.All()
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
 	}
 
-	form := &PostCreateForm{
-		Title:    r.PostForm.Get("title"),
-		Content:  r.PostForm.Get("content"),
-		Category: getCats(catForm),
+	form := parsePostForm(r, categories)
+	var uploads []upload
+	if r.MultipartForm != nil {
+		uploads, err = app.readUploads(form, r.MultipartForm.File["attachments"])
+		if err != nil {
+			app.ServerError(w, err, r)
+			return
+		}
 	}
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.CheckFormValue(form.Category), "cats", "At least one category should be checked")
-	if !form.Valid() || !catForm.Valid() {
+	if !form.Valid() {
 		data := app.NewTemplateData(r)
 		data.Form = form
-		data.Categories = app.categories
+		data.Categories = categories
 		app.Render(w, http.StatusUnprocessableEntity, "create.html", data, r)
 		return
 	}
 
-	session, err := app.CheckSession(w, r)
+	session := app.session(r)
+	if session == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userName := session.UserName
+	id, err := app.Posts.Insert(form.Title, form.Content, form.CategoryIDs, userName)
 	if err != nil {
 		app.ServerError(w, err, r)
 		return
 	}
+	if err = app.saveUploads(id, uploads); err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/post/view/%d", id), http.StatusSeeOther)
+}
+
+// parsePostForm reads and validates the fields shared by the create and edit
+// forms. The request form must already be parsed. Category IDs that are not
+// in categories are ignored.
+func parsePostForm(r *http.Request, categories []models.Category) *PostCreateForm {
+	form := &PostCreateForm{
+		Title:   r.PostForm.Get("title"),
+		Content: r.PostForm.Get("content"),
+	}
+	for _, value := range r.PostForm["category"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		for _, c := range categories {
+			if c.ID == id && !containsID(form.CategoryIDs, id) {
+				form.CategoryIDs = append(form.CategoryIDs, id)
+			}
+		}
+	}
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, maxPostChars), "content", fmt.Sprintf("This field cannot be more than %d characters long", maxPostChars))
+	form.CheckField(len(form.CategoryIDs) > 0, "cats", "At least one category should be checked")
+	return form
+}
+
+// authorPost loads the post whose id follows prefix in the URL and checks
+// that the current user wrote it. On failure it writes the response itself
+// and returns nil.
+func (app *Application) authorPost(w http.ResponseWriter, r *http.Request, prefix string) *models.Post {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return nil
+	}
+
+	post, err := app.Posts.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
+		}
+		return nil
+	}
+
+	session := app.session(r)
 	if session == nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return nil
+	}
+	if post.UserName != session.UserName {
+		app.Forbidden(w, r)
+		return nil
+	}
+	return post
+}
+
+func (app *Application) PostEdit(w http.ResponseWriter, r *http.Request) {
+	post := app.authorPost(w, r, "/post/edit/")
+	if post == nil {
 		return
 	}
-	userName := session.UserName
-	id, err := app.Posts.Insert(form.Title, form.Content, form.Category, userName)
+
+	categories, err := app.Categories.All()
 	if err != nil {
 		app.ServerError(w, err, r)
 		return
 	}
-	http.Redirect(w, r, fmt.Sprintf("/post/view/%d", id), http.StatusSeeOther)
+
+	form := PostCreateForm{
+		Title:   post.Title,
+		Content: post.Content,
+	}
+	for _, c := range categories {
+		if contains(post.Categories, c.Name) {
+			form.CategoryIDs = append(form.CategoryIDs, c.ID)
+		}
+	}
+
+	data := app.NewTemplateData(r)
+	data.Post = post
+	data.Categories = categories
+	data.Form = form
+	app.Render(w, http.StatusOK, "edit.html", data, r)
 }
 
-func getCats(form *CategoriesForm) string {
-	var cats string
-	if form.Entertainment != "" {
-		cats += form.Entertainment + " "
+func (app *Application) PostEditPost(w http.ResponseWriter, r *http.Request) {
+	post := app.authorPost(w, r, "/post/edit/")
+	if post == nil {
+		return
 	}
-	if form.Health != "" {
-		cats += form.Health + " "
+
+	err := r.ParseForm()
+	if err != nil {
+		app.ClientError(w, r)
+		return
 	}
-	if form.Technology != "" {
-		cats += form.Technology + " "
+
+	categories, err := app.Categories.All()
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
 	}
-	if form.Travel != "" {
-		cats += form.Travel + " "
+
+	form := parsePostForm(r, categories)
+	if !form.Valid() {
+		data := app.NewTemplateData(r)
+		data.Post = post
+		data.Form = form
+		data.Categories = categories
+		app.Render(w, http.StatusUnprocessableEntity, "edit.html", data, r)
+		return
 	}
 
-	return cats
+	err = app.Posts.Update(post.ID, form.Title, form.Content, form.CategoryIDs)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/post/view/%d", post.ID), http.StatusSeeOther)
+}
+
+func (app *Application) PostDelete(w http.ResponseWriter, r *http.Request) {
+	post := app.authorPost(w, r, "/post/delete/")
+	if post == nil {
+		return
+	}
+
+	attachments, err := app.Attachments.ForPost(post.ID)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	err = app.Posts.Delete(post.ID)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	app.deleteFiles(attachments)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (app *Application) UserSignup(w http.ResponseWriter, r *http.Request) {
@@ -415,6 +870,7 @@ func (app *Application) UserLoginPost(w http.ResponseWriter, r *http.Request) {
 	form := UserLoginForm{
 		Email:    strings.ToLower(r.PostForm.Get("email")),
 		Password: r.PostForm.Get("password"),
+		Remember: r.PostForm.Get("remember") != "",
 	}
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
@@ -444,64 +900,199 @@ func (app *Application) UserLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, expiration, err := app.Posts.CreateSession(id, userName)
-	if err != nil {
-		app.ServerError(w, err, r)
-		return
+	// Signing in always starts a new session with a new token, so that a
+	// token planted in the browser beforehand is worth nothing.
+	if old := app.session(r); old != nil {
+		err = app.Sessions.DeleteSession(old.UserID, old.ID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.ServerError(w, err, r)
+			return
+		}
 	}
 
-	cookie := &http.Cookie{
-		Name:    "session_token",
-		Value:   token,
-		Expires: expiration,
-		Path:    "/",
+	session := &models.Session{
+		UserID:    id,
+		UserName:  userName,
+		Remember:  form.Remember,
+		IP:        app.clientIP(r),
+		UserAgent: userAgent(r),
+	}
+	if err = app.Sessions.CreateSession(session); err != nil {
+		app.ServerError(w, err, r)
+		return
 	}
-	http.SetCookie(w, cookie)
+	app.setSessionCookie(w, r, session)
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (app *Application) UserLogout(w http.ResponseWriter, r *http.Request) {
-	session, err := app.CheckSession(w, r)
+	session := app.session(r)
+
+	// Only this browser is signed out, see UserSessions for the others.
+	if session != nil {
+		err := app.Sessions.DeleteSession(session.UserID, session.ID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.ServerError(w, err, r)
+			return
+		}
+	}
+	app.clearSessionCookie(w, r)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// UserSessions lists the browsers the user is signed in on.
+func (app *Application) UserSessions(w http.ResponseWriter, r *http.Request) {
+	session := app.session(r)
+	sessions, err := app.Sessions.UserSessions(session.UserID)
 	if err != nil {
 		app.ServerError(w, err, r)
 		return
 	}
 
-	if session != nil {
-		err = app.Posts.DeleteSessionByUserId(session.UserID)
-		if err != nil {
+	data := app.NewTemplateData(r)
+	data.Sessions = sessions
+	data.SessionID = session.ID
+	app.Render(w, http.StatusOK, "sessions.html", data, r)
+}
+
+// UserSessionRevoke signs out the session named by the "id" form field.
+// Revoking the current session works like logging out.
+func (app *Application) UserSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.ClientError(w, r)
+		return
+	}
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
+	}
+
+	session := app.session(r)
+	err = app.Sessions.DeleteSession(session.UserID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
 			app.ServerError(w, err, r)
-			return
 		}
+		return
 	}
-	cookie := &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		Expires: time.Now().AddDate(-1, 0, 0),
-		Path:    "/",
+
+	if id == session.ID {
+		app.clearSessionCookie(w, r)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
-	http.SetCookie(w, cookie)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+// UserSessionRevokeOthers signs out every session of the user but the
+// current one.
+func (app *Application) UserSessionRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	session := app.session(r)
+	if err := app.Sessions.DeleteOtherSessions(session.UserID, session.ID); err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
 }
 
 func (app *Application) isAuthenticated(r *http.Request) bool {
-	cookie, err := r.Cookie("session_token")
-	if err != nil {
+	return app.session(r) != nil
+}
+
+// isAdmin reports whether the request comes from a signed in administrator.
+func (app *Application) isAdmin(r *http.Request) bool {
+	session := app.session(r)
+	if session == nil {
 		return false
 	}
-	token := cookie.Value
 
-	session, err := app.Posts.GetSessionFromToken(token)
+	user, err := app.Users.Get(session.UserID)
 	if err != nil {
 		return false
 	}
+	return user.Role == models.RoleAdmin
+}
 
-	if session.ExpirationDate.Before(time.Now()) {
-		return false
+func (app *Application) AdminCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := app.Categories.All()
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+
+	data := app.NewTemplateData(r)
+	data.Categories = categories
+	data.Form = CategoryForm{}
+	app.Render(w, http.StatusOK, "categories.html", data, r)
+}
+
+func (app *Application) AdminCategoriesPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.ClientError(w, r)
+		return
+	}
+
+	form := CategoryForm{Name: strings.TrimSpace(r.PostForm.Get("name"))}
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 50), "name", "This field cannot be more than 50 characters long")
+	form.CheckField(!strings.ContainsAny(form.Name, " \t\n"), "name", "Category names cannot contain spaces")
+
+	if form.Valid() {
+		_, err = app.Categories.Insert(form.Name)
+		if errors.Is(err, models.ErrDuplicateEntry) {
+			form.AddFieldError("name", "This category already exists")
+		} else if err != nil {
+			app.ServerError(w, err, r)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		categories, err := app.Categories.All()
+		if err != nil {
+			app.ServerError(w, err, r)
+			return
+		}
+		data := app.NewTemplateData(r)
+		data.Categories = categories
+		data.Form = form
+		app.Render(w, http.StatusUnprocessableEntity, "categories.html", data, r)
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+func (app *Application) AdminCategoryDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/admin/categories/delete/"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return
 	}
 
-	return true
+	err = app.Categories.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
+		}
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// AdminJobs shows how the background jobs last ran.
+func (app *Application) AdminJobs(w http.ResponseWriter, r *http.Request) {
+	data := app.NewTemplateData(r)
+	if app.Jobs != nil {
+		data.Jobs = app.Jobs.Status()
+	}
+	app.Render(w, http.StatusOK, "jobs.html", data, r)
 }
 
 func (app *Application) ErrorHandler(w http.ResponseWriter, errorNum int, r *http.Request) {
@@ -511,7 +1102,7 @@ func (app *Application) ErrorHandler(w http.ResponseWriter, errorNum int, r *htt
 		Text:   http.StatusText(errorNum),
 	}
 	data.ErrorStruct = Res
-	err := app.renderErr(w, http.StatusUnprocessableEntity, "error.html", data, r)
+	err := app.renderErr(w, errorNum, "error.html", data, r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintln(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
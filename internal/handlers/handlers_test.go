@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"dyelesho/forum/internal/models"
+)
+
+func TestHome(t *testing.T) {
+	app := newTestApplication(t)
+	if _, err := app.Posts.Insert("First post", "Hello", []int{1}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, app.Routes())
+
+	res := ts.get(t, "/")
+	if res.status != http.StatusOK {
+		t.Fatalf("status %d, want %d", res.status, http.StatusOK)
+	}
+	if !strings.Contains(res.body, "First post") {
+		t.Error("the post is not listed")
+	}
+
+	for _, path := range []string{"/?sort=best", "/?period=year", "/?after=nonsense"} {
+		if res := ts.get(t, path); res.status != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", path, res.status, http.StatusBadRequest)
+		}
+	}
+	if res := ts.get(t, "/missing"); res.status != http.StatusNotFound {
+		t.Errorf("GET /missing: status %d, want %d", res.status, http.StatusNotFound)
+	}
+}
+
+func TestPostView(t *testing.T) {
+	app := newTestApplication(t)
+	id, err := app.Posts.Insert("A title", "Some *content*", []int{2}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, app.Routes())
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/post/view/1", http.StatusOK, "<em>content</em>"},
+		{"/post/view/2", http.StatusNotFound, ""},
+		{"/post/view/-1", http.StatusNotFound, ""},
+		{"/post/view/abc", http.StatusNotFound, ""},
+		{"/post/view/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		res := ts.get(t, tt.path)
+		if res.status != tt.status {
+			t.Errorf("GET %s: status %d, want %d", tt.path, res.status, tt.status)
+		}
+		if !strings.Contains(res.body, tt.body) {
+			t.Errorf("GET %s: body does not contain %q", tt.path, tt.body)
+		}
+	}
+
+	// Only signed in users get the comment form.
+	if strings.Contains(ts.get(t, "/post/view/1").body, `name="comment"`) {
+		t.Error("anonymous visitors see the comment form")
+	}
+	ts.signup(t, "bob")
+	if !strings.Contains(ts.get(t, "/post/view/1").body, `name="comment"`) {
+		t.Error("signed in users do not see the comment form")
+	}
+
+	res := ts.postForm(t, "/post/view/1", url.Values{"comment": {"Nice post"}})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("comment: status %d, want %d", res.status, http.StatusSeeOther)
+	}
+	comments, err := app.Comments.GetComments(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || comments[0].Author != "bob" || comments[0].CContent != "Nice post" {
+		t.Errorf("comments = %+v", comments)
+	}
+
+	// The forms of comments and replies carry the token of the page.
+	res = ts.postForm(t, "/post/view/1", url.Values{"comment": {"Thanks"}, "parent_id": {"1"}})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("reply: status %d, want %d", res.status, http.StatusSeeOther)
+	}
+	token := `name="csrf_token" value="` + ts.csrfToken(t) + `"`
+	body := ts.get(t, "/post/view/1").body
+	if n := strings.Count(body, token); n < 2*(len(models.ReactionKinds)+2) {
+		t.Errorf("%d forms carry the CSRF token, want one per reaction, reply and delete form of both comments", n)
+	}
+	if strings.Contains(body, `name="csrf_token" value=""`) {
+		t.Error("a form has an empty CSRF token")
+	}
+
+	// The page shows the reactions per kind and the one the viewer picked.
+	res = ts.postForm(t, "/post/react", url.Values{"id": {"1"}, "kind": {"heart"}})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("react: status %d, want %d", res.status, http.StatusSeeOther)
+	}
+	body = ts.get(t, "/post/view/1").body
+	if !strings.Contains(body, `data-kind="heart" aria-pressed="true"`) {
+		t.Error("the reaction of the viewer is not marked")
+	}
+	if !strings.Contains(body, `<strong data-count="heart">1</strong>`) {
+		t.Error("the heart count is not 1")
+	}
+
+	for _, path := range []string{"/post/react", "/comment/react"} {
+		res = ts.postForm(t, path, url.Values{"id": {"99"}, "kind": {"heart"}})
+		if res.status != http.StatusNotFound {
+			t.Errorf("%s to a missing target: status %d, want %d", path, res.status, http.StatusNotFound)
+		}
+	}
+}
+
+func TestUserLogin(t *testing.T) {
+	app := newTestApplication(t)
+	if err := app.Users.Insert("alice", "alice@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServer(t, app.Routes())
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		status   int
+	}{
+		{"blank", "", "", http.StatusUnprocessableEntity},
+		{"bad email", "alice", "password123", http.StatusUnprocessableEntity},
+		{"wrong password", "alice@example.com", "wrong-password", http.StatusUnprocessableEntity},
+		{"unknown user", "bob@example.com", "password123", http.StatusUnprocessableEntity},
+		{"valid", "ALICE@example.com", "password123", http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.postForm(t, "/user/login", url.Values{"email": {tt.email}, "password": {tt.password}})
+			if res.status != tt.status {
+				t.Errorf("status %d, want %d", res.status, tt.status)
+			}
+		})
+	}
+
+	if !strings.Contains(ts.get(t, "/").body, "Logout") {
+		t.Error("the user is not signed in after logging in")
+	}
+}
+
+func TestUserLogout(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.Routes())
+	ts.signup(t, "alice")
+
+	// A link or an image on another site must not sign users out.
+	if res := ts.get(t, "/user/logout"); res.status != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want %d", res.status, http.StatusMethodNotAllowed)
+	}
+	if res := ts.get(t, "/user/logout/"); res.status != http.StatusNotFound {
+		t.Errorf("GET with a slash: status %d, want %d", res.status, http.StatusNotFound)
+	}
+	if !strings.Contains(ts.get(t, "/").body, "Logout") {
+		t.Fatal("the user was signed out by a GET request")
+	}
+
+	res := ts.postForm(t, "/user/logout", url.Values{})
+	if res.status != http.StatusSeeOther {
+		t.Errorf("POST: status %d, want %d", res.status, http.StatusSeeOther)
+	}
+	if strings.Contains(ts.get(t, "/").body, "Logout") {
+		t.Error("the user is still signed in")
+	}
+}
+
+func TestPostCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.Routes())
+
+	res := ts.get(t, "/post/create")
+	if res.status != http.StatusSeeOther || res.header.Get("Location") != "/user/login" {
+		t.Fatalf("anonymous: status %d to %q, want a redirect to the login page", res.status, res.header.Get("Location"))
+	}
+
+	ts.signup(t, "alice")
+	if res := ts.get(t, "/post/create"); res.status != http.StatusOK {
+		t.Fatalf("GET /post/create: status %d", res.status)
+	}
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{"blank title", url.Values{"title": {""}, "content": {"c"}, "category": {"1"}}, http.StatusUnprocessableEntity},
+		{"long title", url.Values{"title": {strings.Repeat("t", 101)}, "content": {"c"}, "category": {"1"}}, http.StatusUnprocessableEntity},
+		{"blank content", url.Values{"title": {"t"}, "content": {" "}, "category": {"1"}}, http.StatusUnprocessableEntity},
+		{"long content", url.Values{"title": {"t"}, "content": {strings.Repeat("c", maxPostChars+1)}, "category": {"1"}}, http.StatusUnprocessableEntity},
+		{"no category", url.Values{"title": {"t"}, "content": {"c"}}, http.StatusUnprocessableEntity},
+		{"unknown category", url.Values{"title": {"t"}, "content": {"c"}, "category": {"99"}}, http.StatusUnprocessableEntity},
+		{"valid", url.Values{"title": {"My post"}, "content": {"Hello"}, "category": {"1", "3"}}, http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := ts.postForm(t, "/post/create", tt.form)
+			if res.status != tt.status {
+				t.Errorf("status %d, want %d", res.status, tt.status)
+			}
+		})
+	}
+
+	post, err := app.Posts.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "My post" || post.UserName != "alice" || len(post.Categories) != 2 {
+		t.Errorf("post = %+v", post)
+	}
+	if _, err := app.Posts.Get(2); err == nil {
+		t.Error("an invalid form created a post")
+	}
+}
@@ -7,7 +7,11 @@ import (
 	"net/http"
 	"regexp"
 	"runtime/debug"
+	"strings"
 	"time"
+
+	"dyelesho/forum/internal/diff"
+	"dyelesho/forum/internal/models"
 )
 
 func (app *Application) ServerError(w http.ResponseWriter, err error, r *http.Request) {
@@ -30,6 +34,10 @@ func (app *Application) ClientError(w http.ResponseWriter, r *http.Request) {
 	app.ErrorHandler(w, http.StatusBadRequest, r)
 }
 
+func (app *Application) Forbidden(w http.ResponseWriter, r *http.Request) {
+	app.ErrorHandler(w, http.StatusForbidden, r)
+}
+
 func (app *Application) Render(w http.ResponseWriter, status int, page string, data *TemplateData, r *http.Request) {
 	ts, ok := app.TemplateCache[page]
 	var err error
@@ -67,7 +75,41 @@ func (app *Application) NewTemplateData(r *http.Request) *TemplateData {
 	return &TemplateData{
 		CurrentYear:     time.Now().Year(),
 		IsAuthenticated: app.isAuthenticated(r),
+		IsAdmin:         app.isAdmin(r),
+		CSRFToken:       app.csrfToken(r),
+	}
+}
+
+// PostChange describes one edit of a post: what the title and category were
+// changed from and to, and a line diff of the content.
+type PostChange struct {
+	Edited      time.Time
+	OldTitle    string
+	NewTitle    string
+	OldCategory string
+	NewCategory string
+	Lines       []diff.Line
+}
+
+// postHistory turns the stored revisions of a post into a list of changes,
+// newest first.
+func postHistory(post *models.Post, revisions []models.PostRevision) []PostChange {
+	changes := make([]PostChange, len(revisions))
+	for i, rev := range revisions {
+		next := models.PostRevision{Title: post.Title, Content: post.Content, Category: strings.Join(post.Categories, " ")}
+		if i+1 < len(revisions) {
+			next = revisions[i+1]
+		}
+		changes[len(revisions)-1-i] = PostChange{
+			Edited:      rev.Edited,
+			OldTitle:    rev.Title,
+			NewTitle:    next.Title,
+			OldCategory: rev.Category,
+			NewCategory: next.Category,
+			Lines:       diff.Lines(rev.Content, next.Content),
+		}
 	}
+	return changes
 }
 
 func HtmlInjectionCheck(input string) bool {
@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"context"
+	"crypto/hmac"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
+
+	"dyelesho/forum/internal/models"
 )
 
 func SecureHeaders(next http.Handler) http.Handler {
@@ -36,13 +42,85 @@ func (app *Application) RecoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *Application) RequireAuthentication(next http.Handler) http.Handler {
+// LoadSession looks up the session named by the session cookie, slides its
+// expiry forward, notes where it was used from and stores it in the request
+// context, where handlers find it with app.session. A cookie that names no
+// live session is cleared.
+func (app *Application) LoadSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		err := app.DeleteExpiredSessions()
+		cookie, err := r.Cookie(sessionCookie)
 		if err != nil {
-			app.ErrorLog.Println(err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, err := app.Sessions.GetSessionFromToken(cookie.Value)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clearSessionCookie(w, r)
+			next.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			app.ServerError(w, err, r)
+			return
+		}
+
+		now := time.Now().UTC()
+		if expires, ok := session.Renewal(now); ok {
+			session.ExpirationDate = expires
+			session.LastSeen = now
+			session.IP = app.clientIP(r)
+			session.UserAgent = userAgent(r)
+			if err = app.Sessions.RenewSession(session); err != nil {
+				app.ServerError(w, err, r)
+				return
+			}
+			app.setSessionCookie(w, r, session)
+		}
+
+		ctx := context.WithValue(r.Context(), sessionContextKey, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CSRF issues the token that forms send back and rejects unsafe requests
+// that come without it. Signed in users get a token derived from their
+// session, anonymous visitors one derived from a cookie set on their first
+// visit. It must be wrapped by LoadSession.
+func (app *Application) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var secret string
+		if session := app.session(r); session != nil {
+			secret = session.Token
+		} else if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+			secret = cookie.Value
+		} else {
+			secret, err = models.NewToken()
+			if err != nil {
+				app.ServerError(w, err, r)
+				return
+			}
+			app.setCookie(w, r, csrfCookie, secret, time.Time{})
 		}
 
+		token := deriveCSRFToken(secret)
+		r = r.WithContext(context.WithValue(r.Context(), csrfContextKey, token))
+		if !isSafeMethod(r.Method) {
+			submitted, err := submittedCSRFToken(w, r)
+			if err != nil {
+				app.ClientError(w, r)
+				return
+			}
+			if !hmac.Equal([]byte(submitted), []byte(token)) {
+				app.csrfFailed(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *Application) RequireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !app.isAuthenticated(r) {
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
@@ -51,3 +129,14 @@ func (app *Application) RequireAuthentication(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireAdmin must be wrapped by RequireAuthentication.
+func (app *Application) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAdmin(r) {
+			app.Forbidden(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
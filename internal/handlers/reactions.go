@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dyelesho/forum/internal/models"
+)
+
+// reactionResponse is sent to scripts that ask for JSON, so that the page
+// can update the counts without reloading. Likes and Dislikes repeat the
+// like and dislike counts for older scripts.
+type reactionResponse struct {
+	Counts   map[string]int `json:"counts"`
+	Likes    int            `json:"likes"`
+	Dislikes int            `json:"dislikes"`
+	Reaction string         `json:"reaction"`
+}
+
+// ReactionGroup lists the users who gave one kind of reaction.
+type ReactionGroup struct {
+	Kind     models.ReactionKind
+	Reactors []models.Reactor
+}
+
+// ReactToPost toggles the reaction named by the "kind" form field to the
+// post named by the "id" field for the signed in user.
+func (app *Application) ReactToPost(w http.ResponseWriter, r *http.Request) {
+	session, id, kind := app.reactionTarget(w, r)
+	if session == nil {
+		return
+	}
+
+	if err := app.Reactions.ReactToPost(session.UserID, id, kind); err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
+		}
+		return
+	}
+	if !wantsJSON(r) {
+		http.Redirect(w, r, fmt.Sprintf("/post/view/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	summary, err := app.Reactions.PostReactions(session.UserID, id)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	app.writeReaction(w, r, summary)
+}
+
+// ReactToComment is ReactToPost for comments.
+func (app *Application) ReactToComment(w http.ResponseWriter, r *http.Request) {
+	session, id, kind := app.reactionTarget(w, r)
+	if session == nil {
+		return
+	}
+
+	comment, err := app.Comments.GetComment(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(w, r)
+		} else {
+			app.ServerError(w, err, r)
+		}
+		return
+	}
+	if comment.Deleted {
+		app.NotFound(w, r)
+		return
+	}
+
+	if err = app.Reactions.ReactToComment(session.UserID, id, kind); err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	if !wantsJSON(r) {
+		http.Redirect(w, r, fmt.Sprintf("/post/view/%d#comment-%d", comment.PostID, id), http.StatusSeeOther)
+		return
+	}
+
+	summary, err := app.Reactions.CommentReactions(session.UserID, id)
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	app.writeReaction(w, r, summary)
+}
+
+// reactionTarget returns the session of the user reacting, the id of the
+// post or comment and the kind of reaction. It writes the response itself
+// and returns a nil session when the request cannot go on.
+func (app *Application) reactionTarget(w http.ResponseWriter, r *http.Request) (*models.Session, int, string) {
+	if err := r.ParseForm(); err != nil {
+		app.ClientError(w, r)
+		return nil, 0, ""
+	}
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.NotFound(w, r)
+		return nil, 0, ""
+	}
+	kind := r.PostForm.Get("kind")
+	if _, ok := app.reactionKind(kind); !ok {
+		app.ClientError(w, r)
+		return nil, 0, ""
+	}
+
+	session := app.session(r)
+	if session == nil {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return nil, 0, ""
+	}
+	return session, id, kind
+}
+
+// reactionKind looks up one of the kinds users can pick.
+func (app *Application) reactionKind(name string) (models.ReactionKind, bool) {
+	for _, kind := range app.ReactionKinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return models.ReactionKind{}, false
+}
+
+func (app *Application) writeReaction(w http.ResponseWriter, r *http.Request, summary *models.ReactionSummary) {
+	body, err := json.Marshal(reactionResponse{
+		Counts:   summary.Counts,
+		Likes:    summary.Counts[models.ReactionLike],
+		Dislikes: summary.Counts[models.ReactionDislike],
+		Reaction: summary.Viewer,
+	})
+	if err != nil {
+		app.ServerError(w, err, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// listReactions fills in the reaction counts shown under each comment.
+func (app *Application) listReactions(comments []*models.Comment) {
+	for _, c := range comments {
+		c.ReactionList = models.CountReactions(app.ReactionKinds, c.Reactions)
+		app.listReactions(c.Replies)
+	}
+}
+
+// Reactors lists who reacted to a post, under /post/reactions/{id}, or to a
+// comment, under /comment/reactions/{id}, grouped by kind.
+func (app *Application) Reactors(w http.ResponseWriter, r *http.Request) {
+	data := app.NewTemplateData(r)
+	var reactors []models.Reactor
+
+	if idStr := strings.TrimPrefix(r.URL.Path, "/post/reactions/"); idStr != r.URL.Path {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id < 1 {
+			app.NotFound(w, r)
+			return
+		}
+		if data.Post, err = app.Posts.Get(id); err == nil {
+			reactors, err = app.Reactions.PostReactors(id)
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(w, r)
+			} else {
+				app.ServerError(w, err, r)
+			}
+			return
+		}
+	} else {
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/comment/reactions/"))
+		if err != nil || id < 1 {
+			app.NotFound(w, r)
+			return
+		}
+		if data.Comment, err = app.Comments.GetComment(id); err == nil {
+			reactors, err = app.Reactions.CommentReactors(id)
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(w, r)
+			} else {
+				app.ServerError(w, err, r)
+			}
+			return
+		}
+	}
+
+	// Kinds that are no longer offered are still listed, after the others.
+	groups := map[string]*ReactionGroup{}
+	var order []*ReactionGroup
+	for _, kind := range app.ReactionKinds {
+		groups[kind.Name] = &ReactionGroup{Kind: kind}
+		order = append(order, groups[kind.Name])
+	}
+	for _, re := range reactors {
+		g, ok := groups[re.Kind]
+		if !ok {
+			g = &ReactionGroup{Kind: models.ReactionKind{Name: re.Kind, Label: re.Kind}}
+			groups[re.Kind] = g
+			order = append(order, g)
+		}
+		g.Reactors = append(g.Reactors, re)
+	}
+	for _, g := range order {
+		if len(g.Reactors) > 0 {
+			data.ReactionGroups = append(data.ReactionGroups, g)
+		}
+	}
+	app.Render(w, http.StatusOK, "reactions.html", data, r)
+}
@@ -2,13 +2,11 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 	"strings"
 )
 
 func (app *Application) Routes() http.Handler {
 	mux := http.NewServeMux()
-	app.categories = []string{"Technology", "Travel", "Health", "Entertainment"}
 	fileServer := http.FileServer(http.Dir("./ui/static/"))
 	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
@@ -21,13 +19,21 @@ func (app *Application) Routes() http.Handler {
 	})
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet || r.Method == http.MethodPost {
+		if r.Method == http.MethodGet {
 			app.Home(w, r)
 		} else {
 			MethodNotAllowedHandler(w, r, []string{http.MethodGet})
 		}
 	})
 
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			app.SearchView(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet})
+		}
+	})
+
 	mux.HandleFunc("/post/view/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			app.PostView(w, r)
@@ -37,6 +43,13 @@ func (app *Application) Routes() http.Handler {
 			MethodNotAllowedHandler(w, r, []string{http.MethodGet, http.MethodPost})
 		}
 	})
+	mux.HandleFunc("/attachments/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			app.AttachmentView(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet})
+		}
+	})
 	mux.Handle("/post/create", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -48,84 +61,103 @@ func (app *Application) Routes() http.Handler {
 		}
 	})))
 
-	mux.Handle("/likePost", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := app.CheckSession(w, r)
-		if err != nil {
-			app.ServerError(w, err, r)
-			return
-		}
-		if session == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-		userID := session.UserID
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil || id < 1 {
-			app.NotFound(w, r)
-			return
+	mux.Handle("/preview", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.Preview(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
 		}
+	})))
 
-		_ = app.Reactions.LikePost(userID, id)
-		http.Redirect(w, r, r.Header.Get("Referer"), http.StatusSeeOther)
+	mux.Handle("/post/edit/", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.PostEdit(w, r)
+		case http.MethodPost:
+			app.PostEditPost(w, r)
+		default:
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet, http.MethodPost})
+		}
 	})))
-	mux.Handle("/dislikePost", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := app.CheckSession(w, r)
-		if err != nil {
-			app.ServerError(w, err, r)
-			return
-		}
-		if session == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-		userID := session.UserID
-		id, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil || id < 1 {
-			app.NotFound(w, r)
-			return
+	mux.Handle("/post/delete/", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.PostDelete(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
 		}
+	})))
 
-		_ = app.Reactions.DislikePost(userID, id)
-		http.Redirect(w, r, r.Header.Get("Referer"), http.StatusSeeOther)
+	mux.Handle("/comment/edit/", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.CommentEdit(w, r)
+		case http.MethodPost:
+			app.CommentEditPost(w, r)
+		default:
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet, http.MethodPost})
+		}
 	})))
-	mux.Handle("/likeComment", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := app.CheckSession(w, r)
-		if err != nil {
-			app.ServerError(w, err, r)
-			return
-		}
-		if session == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-		userID := session.UserID
-		commentID, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil || commentID < 1 {
-			app.NotFound(w, r)
-			return
-		}
-		_ = app.Reactions.LikeComment(userID, commentID)
-		http.Redirect(w, r, r.Header.Get("Referer"), http.StatusSeeOther)
+	mux.Handle("/comment/delete/", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.CommentDelete(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
+		}
 	})))
-	mux.Handle("/dislikeComment", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := app.CheckSession(w, r)
-		if err != nil {
-			app.ServerError(w, err, r)
-			return
-		}
-		if session == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-		userID := session.UserID
-		commentID, err := strconv.Atoi(r.URL.Query().Get("id"))
-		if err != nil || commentID < 1 {
-			app.NotFound(w, r)
-			return
-		}
-		_ = app.Reactions.DislikeComment(userID, commentID)
-		http.Redirect(w, r, r.Header.Get("Referer"), http.StatusSeeOther)
+
+	mux.Handle("/post/react", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.ReactToPost(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
+		}
+	})))
+	mux.Handle("/comment/react", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.ReactToComment(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
+		}
 	})))
+	mux.HandleFunc("/post/reactions/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			app.Reactors(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet})
+		}
+	})
+	mux.HandleFunc("/comment/reactions/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			app.Reactors(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet})
+		}
+	})
+	mux.Handle("/admin/categories", app.RequireAuthentication(app.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.AdminCategories(w, r)
+		case http.MethodPost:
+			app.AdminCategoriesPost(w, r)
+		default:
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet, http.MethodPost})
+		}
+	}))))
+	mux.Handle("/admin/categories/delete/", app.RequireAuthentication(app.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.AdminCategoryDelete(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
+		}
+	}))))
+	mux.Handle("/admin/jobs", app.RequireAuthentication(app.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			app.AdminJobs(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodGet})
+		}
+	}))))
+
 	mux.HandleFunc("/user/signup", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -148,15 +180,37 @@ func (app *Application) Routes() http.Handler {
 		}
 	})
 
-	mux.Handle("/user/logout/", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost || r.Method == http.MethodGet {
-			app.UserLogout(w, r)
+	mux.Handle("/user/sessions", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			app.UserSessions(w, r)
 		} else {
 			MethodNotAllowedHandler(w, r, []string{http.MethodGet})
 		}
 	})))
+	mux.Handle("/user/sessions/revoke", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.UserSessionRevoke(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
+		}
+	})))
+	mux.Handle("/user/sessions/revoke-others", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.UserSessionRevokeOthers(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
+		}
+	})))
+
+	mux.Handle("/user/logout", app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			app.UserLogout(w, r)
+		} else {
+			MethodNotAllowedHandler(w, r, []string{http.MethodPost})
+		}
+	})))
 
-	return app.RecoverPanic(app.LogRequest(SecureHeaders(mux)))
+	return app.RecoverPanic(app.LogRequest(SecureHeaders(app.LoadSession(app.CSRF(mux)))))
 }
 
 func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request, allowedMethods []string) {
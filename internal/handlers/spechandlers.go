@@ -1,41 +1,49 @@
 package handlers
 
 import (
-	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"dyelesho/forum/internal/models"
 )
 
-func (app *Application) CheckSession(w http.ResponseWriter, r *http.Request) (*models.Session, error) {
-	token, err := r.Cookie("session_token")
-	if err != nil {
-		if errors.Is(err, http.ErrNoCookie) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	session, err := app.Posts.GetSessionFromToken(token.Value)
-	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			http.SetCookie(w, &http.Cookie{
-				Name:    "session_token",
-				Value:   "",
-				Expires: time.Now().Add(-1 * time.Minute),
-			})
-			return nil, nil
-		} else {
-			return nil, err
-		}
+// sessionCookie names the cookie that carries the session token.
+const sessionCookie = "session_token"
+
+type contextKey string
+
+const sessionContextKey = contextKey("session")
+
+// session returns the session LoadSession found for r, or nil when the
+// request comes from an anonymous visitor.
+func (app *Application) session(r *http.Request) *models.Session {
+	session, _ := r.Context().Value(sessionContextKey).(*models.Session)
+	return session
+}
+
+// setSessionCookie hands the session token to the browser. Sessions started
+// with "remember me" outlive the browser; the others end with it, or
+// earlier when they expire on the server.
+func (app *Application) setSessionCookie(w http.ResponseWriter, r *http.Request, session *models.Session) {
+	var expires time.Time
+	if session.Remember {
+		expires = session.ExpirationDate
 	}
-	return session, nil
+	app.setCookie(w, r, sessionCookie, session.Token, expires)
+}
+
+func (app *Application) clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	app.clearCookie(w, r, sessionCookie)
 }
 
-func (app *Application) DeleteExpiredSessions() error {
-	err := app.Posts.DeleteExpiredSessions()
-	if err != nil {
-		app.ErrorLog.Println(err)
+// maxUserAgent caps how much of the User-Agent header is stored.
+const maxUserAgent = 256
+
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgent {
+		ua = strings.ToValidUTF8(ua[:maxUserAgent], "")
 	}
-	return err
+	return ua
 }
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"html/template"
 	"path/filepath"
-	"text/template"
+	"strings"
 	"time"
 
+	"dyelesho/forum/internal/markdown"
 	"dyelesho/forum/internal/models"
+	"dyelesho/forum/internal/scheduler"
 )
 
 type TemplateData struct {
@@ -15,18 +18,104 @@ type TemplateData struct {
 	Form            any
 	IsAuthenticated bool
 	Category        string
-	Categories      []string
-	Comments        []models.Comment
+	Categories      []models.Category
+	Comment         *models.Comment
+	Comments        []*models.Comment
+	Attachments     []models.Attachment
+	ReactionGroups  []*ReactionGroup
 	ErrorStruct     *ErrorStruct
 	CommentError    bool
+	History         []PostChange
+	IsAuthor        bool
+	IsAdmin         bool
+	Filter          models.PostFilter
+	Show            string
+	Total           int
+	Results         []models.SearchResult
+	PrevURL         string
+	NextURL         string
+	Sessions        []models.Session
+	SessionID       int
+	CSRFToken       string
+	Jobs            []scheduler.Status
+}
+
+// CommentView is what the "comment" template renders: a comment along with
+// the CSRF token its forms send, which belongs to the request rather than
+// the comment.
+type CommentView struct {
+	*models.Comment
+	CSRFToken string
+}
+
+func commentView(c *models.Comment, csrfToken string) CommentView {
+	return CommentView{Comment: c, CSRFToken: csrfToken}
 }
 
 func HumanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(list []int, value int) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// renderMarkdown renders user text as sanitized HTML.
+func renderMarkdown(s string) template.HTML {
+	return template.HTML(markdown.Render(s))
+}
+
+// describeDevice names the browser and system in a User-Agent header, such
+// as "Firefox on Linux", falling back to the header itself.
+func describeDevice(ua string) string {
+	var browser, system string
+	for _, b := range [][2]string{{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"}} {
+		if strings.Contains(ua, b[0]) {
+			browser = b[1]
+			break
+		}
+	}
+	for _, o := range [][2]string{{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iOS"}, {"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"}} {
+		if strings.Contains(ua, o[0]) {
+			system = o[1]
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case ua != "":
+		return ua
+	}
+	return "Unknown device"
+}
+
 var functions = template.FuncMap{
-	"humanDate": HumanDate,
+	"humanDate":   HumanDate,
+	"contains":    contains,
+	"containsID":  containsID,
+	"markdown":    renderMarkdown,
+	"fileSize":    formatSize,
+	"device":      describeDevice,
+	"commentView": commentView,
 }
 
 func NewTemplateCache() (map[string]*template.Template, error) {
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"dyelesho/forum/internal/models/memory"
+	"dyelesho/forum/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	// Templates and static files are looked up from the repository root.
+	if err := os.Chdir("../.."); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestApplication returns an Application backed by the memory stores,
+// which logs nothing.
+func newTestApplication(t *testing.T) *Application {
+	t.Helper()
+	templateCache, err := NewTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	discard := log.New(io.Discard, "", 0)
+	app := NewApplication(discard, discard, templateCache, memory.NewStores())
+	app.Files = storage.NewMemory()
+	return app
+}
+
+// testServer is a running application with a browser-like client that keeps
+// cookies but does not follow redirects.
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+	return newClient(t, httptest.NewServer(h))
+}
+
+// newTLSTestServer is newTestServer served over HTTPS.
+func newTLSTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+	return newClient(t, httptest.NewTLSServer(h))
+}
+
+func newClient(t *testing.T, ts *httptest.Server) *testServer {
+	t.Helper()
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &testServer{ts}
+}
+
+type testResponse struct {
+	status  int
+	header  http.Header
+	cookies []*http.Cookie
+	body    string
+}
+
+func (ts *testServer) do(t *testing.T, req *http.Request) testResponse {
+	t.Helper()
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testResponse{res.StatusCode, res.Header, res.Cookies(), string(body)}
+}
+
+func (ts *testServer) get(t *testing.T, path string) testResponse {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.do(t, req)
+}
+
+// postForm sends form to path along with the CSRF token of the page at
+// path, like a browser submitting a form it was shown.
+func (ts *testServer) postForm(t *testing.T, path string, form url.Values) testResponse {
+	t.Helper()
+	form.Set(csrfField, ts.csrfToken(t))
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return ts.do(t, req)
+}
+
+var csrfMetaRX = regexp.MustCompile(`<meta name='csrf-token' content='([^']*)'>`)
+
+// csrfToken returns the CSRF token pages currently carry for the client.
+func (ts *testServer) csrfToken(t *testing.T) string {
+	t.Helper()
+	m := csrfMetaRX.FindStringSubmatch(ts.get(t, "/").body)
+	if m == nil {
+		t.Fatal("no CSRF token in the page")
+	}
+	return m[1]
+}
+
+// signup registers name with the password "password123" and signs the
+// client in.
+func (ts *testServer) signup(t *testing.T, name string) testResponse {
+	t.Helper()
+	res := ts.postForm(t, "/user/signup", url.Values{
+		"name":     {name},
+		"email":    {name + "@example.com"},
+		"password": {"password123"},
+	})
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("signup of %s: status %d", name, res.status)
+	}
+	return ts.login(t, name, false)
+}
+
+func (ts *testServer) login(t *testing.T, name string, remember bool) testResponse {
+	t.Helper()
+	form := url.Values{"email": {name + "@example.com"}, "password": {"password123"}}
+	if remember {
+		form.Set("remember", "on")
+	}
+	res := ts.postForm(t, "/user/login", form)
+	if res.status != http.StatusSeeOther {
+		t.Fatalf("login of %s: status %d", name, res.status)
+	}
+	return res
+}
@@ -0,0 +1,162 @@
+// Package imaging prepares uploaded images: it strips metadata from JPEG
+// files and makes thumbnails, using only the standard image packages.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+var ErrInvalidJPEG = errors.New("imaging: invalid JPEG")
+
+// JPEG markers.
+const (
+	markerSOI   = 0xd8
+	markerSOS   = 0xda
+	markerAPP1  = 0xe1 // Exif and XMP
+	markerAPP13 = 0xed // Photoshop IRB and IPTC
+)
+
+// StripJPEGMetadata removes the APP1 and APP13 segments from a JPEG file.
+// They carry Exif, XMP and IPTC metadata, which can include the camera
+// owner and the GPS position. Other segments, the ICC profile among them,
+// are kept, and the image data itself is copied unchanged.
+//
+// The Exif orientation tag goes with the rest, so photos that rely on it
+// are shown as they were taken by the camera sensor.
+func StripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, ErrInvalidJPEG
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	for i := 2; i < len(data); {
+		if data[i] != 0xff {
+			return nil, ErrInvalidJPEG
+		}
+		// Any number of 0xff fill bytes may precede a marker.
+		start := i
+		for i < len(data) && data[i] == 0xff {
+			i++
+		}
+		if i >= len(data) {
+			return nil, ErrInvalidJPEG
+		}
+		marker := data[i]
+		i++
+
+		// Markers without a payload.
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+			out = append(out, data[start:i]...)
+			continue
+		}
+		if i+2 > len(data) {
+			return nil, ErrInvalidJPEG
+		}
+		end := i + (int(data[i])<<8 | int(data[i+1]))
+		if end-i < 2 || end > len(data) {
+			return nil, ErrInvalidJPEG
+		}
+		if marker == markerSOS {
+			// The entropy-coded data runs to the end of the image.
+			return append(out, data[start:]...), nil
+		}
+		if marker != markerAPP1 && marker != markerAPP13 {
+			out = append(out, data[start:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// Config returns the format and the dimensions of an image without decoding
+// all of it, so that oversized images can be refused cheaply.
+func Config(data []byte) (image.Config, string, error) {
+	return image.DecodeConfig(bytes.NewReader(data))
+}
+
+// Thumbnail decodes a GIF, JPEG or PNG image and writes a copy scaled down
+// to fit in a size×size square. JPEG images give JPEG thumbnails, other
+// formats PNG so that transparency survives. It returns the content type
+// of the thumbnail.
+func Thumbnail(w io.Writer, data []byte, size int) (string, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	thumb := scale(src, size)
+	if format == "jpeg" {
+		return "image/jpeg", jpeg.Encode(w, thumb, &jpeg.Options{Quality: 80})
+	}
+	return "image/png", png.Encode(w, thumb)
+}
+
+// scale shrinks src to fit in a size×size square by averaging the source
+// pixels that fall on each thumbnail pixel. Images that already fit are
+// only copied.
+func scale(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	if tw == w && th == h {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+
+	// draw.Draw has fast paths for the common source types, which makes
+	// reading pixels from an RGBA copy much cheaper than calling At. Only
+	// the band of source rows that falls on one thumbnail row is copied at
+	// a time, as a copy of the whole image would take 4 bytes per pixel.
+	band := image.NewRGBA(image.Rect(0, 0, w, (h+th-1)/th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		if y1 == y0 {
+			y1++
+		}
+		draw.Draw(band, image.Rect(0, 0, w, y1-y0), src, image.Pt(b.Min.X, b.Min.Y+y0), draw.Src)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			if x1 == x0 {
+				x1++
+			}
+			var sum [4]int
+			for sy := 0; sy < y1-y0; sy++ {
+				row := band.Pix[sy*band.Stride+x0*4 : sy*band.Stride+x1*4]
+				for k := 0; k < len(row); k += 4 {
+					sum[0] += int(row[k])
+					sum[1] += int(row[k+1])
+					sum[2] += int(row[k+2])
+					sum[3] += int(row[k+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			p := dst.Pix[y*dst.Stride+x*4:]
+			for k := 0; k < 4; k++ {
+				p[k] = uint8(sum[k] / n)
+			}
+		}
+	}
+	return dst
+}
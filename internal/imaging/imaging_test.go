@@ -0,0 +1,79 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+// scaleReference is scale done the simple way, averaging over a full RGBA
+// copy of src.
+func scaleReference(src image.Image, tw, th int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					for k := 0; k < 4; k++ {
+						sum[k] += int(rgba.Pix[sy*rgba.Stride+sx*4+k])
+					}
+				}
+			}
+			for k := 0; k < 4; k++ {
+				dst.Pix[y*dst.Stride+x*4+k] = uint8(sum[k] / ((y1 - y0) * (x1 - x0)))
+			}
+		}
+	}
+	return dst
+}
+
+func randomImages(rnd *rand.Rand, w, h int) []image.Image {
+	r := image.Rect(3, 5, 3+w, 5+h)
+	nrgba := image.NewNRGBA(r)
+	gray := image.NewGray(r)
+	paletted := image.NewPaletted(r, color.Palette{color.Black, color.White, color.Transparent, color.RGBA{200, 10, 10, 255}})
+	ycbcr := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+	rnd.Read(nrgba.Pix)
+	rnd.Read(gray.Pix)
+	rnd.Read(ycbcr.Y)
+	rnd.Read(ycbcr.Cb)
+	rnd.Read(ycbcr.Cr)
+	for i := range paletted.Pix {
+		paletted.Pix[i] = uint8(rnd.Intn(4))
+	}
+	// A sub-image does not start at the origin of its pixels.
+	sub := nrgba.SubImage(image.Rect(4, 7, 3+w, 5+h))
+	return []image.Image{nrgba, gray, paletted, ycbcr, sub}
+}
+
+func TestScale(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range [][2]int{{640, 480}, {480, 640}, {301, 299}, {1000, 7}, {7, 1000}, {64, 64}, {50, 20}} {
+		for _, src := range randomImages(rnd, size[0], size[1]) {
+			name := fmt.Sprintf("%T %v", src, src.Bounds().Size())
+			got := scale(src, 64)
+			b := src.Bounds()
+			if got.Bounds().Dx() > 64 || got.Bounds().Dy() > 64 {
+				t.Errorf("%s: scaled to %v", name, got.Bounds().Size())
+			}
+			want := scaleReference(src, got.Bounds().Dx(), got.Bounds().Dy())
+			if b.Dx() <= 64 && b.Dy() <= 64 && got.Bounds().Size() != b.Size() {
+				t.Errorf("%s: an image that fits was resized to %v", name, got.Bounds().Size())
+			}
+			if !bytes.Equal(got.Pix, want.Pix) {
+				t.Errorf("%s: pixels differ from averaging a full copy", name)
+			}
+		}
+	}
+}
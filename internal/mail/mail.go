@@ -0,0 +1,26 @@
+// Package mail sends email to users. For now mail is only written to a log,
+// which lets the digest job run without a mail server.
+package mail
+
+import "log"
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by Log.
+type Mailer interface {
+	Send(m Message) error
+}
+
+// Log writes every message to Logger instead of sending it.
+type Log struct {
+	Logger *log.Logger
+}
+
+func (l *Log) Send(m Message) error {
+	l.Logger.Printf("Mail to %s: %s\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
@@ -0,0 +1,344 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// renderInline writes the inline content of a block: code spans, emphasis,
+// links, autolinks, backslash escapes and line breaks. Everything else is
+// escaped text.
+func renderInline(b *strings.Builder, s string) {
+	renderSpan(b, s, true)
+}
+
+// spanState remembers what renderSpan learned about unclosed delimiters in
+// one span, so that every position is scanned for a closer at most once per
+// kind of delimiter instead of once per opener.
+type spanState struct {
+	// dead[k][j] is set once the closer scan for k is known to fail when
+	// it reaches position j. The scan visits the same positions from
+	// wherever it starts, so it can stop there.
+	dead map[delimiter][]bool
+	// unclosed maps a backtick run length to the earliest position from
+	// which a run of that length was found to have no closing run.
+	unclosed map[int]int
+	visited  []int
+	// brackets[i] is the position of the "]" matching a "[" at i, or -1.
+	// It is filled in on the first "[" of the span.
+	brackets []int
+	// Autolinks starting before noAutolink are known not to close.
+	noAutolink int
+}
+
+type delimiter struct {
+	c    byte
+	size int
+}
+
+func renderSpan(b *strings.Builder, s string, links bool) {
+	st := &spanState{dead: map[delimiter][]bool{}, unclosed: map[int]int{}}
+	var text strings.Builder
+	flush := func() {
+		b.WriteString(html.EscapeString(text.String()))
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			flush()
+			b.WriteString("<br>\n")
+			i += 2
+			continue
+
+		case c == '\n':
+			flush()
+			b.WriteString("<br>\n")
+			i++
+			continue
+
+		case c == '`':
+			if code, n := st.codeSpan(s, i); n > 0 {
+				flush()
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += n
+				continue
+			}
+			// An unmatched run of backticks is literal text.
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case c == '[' && links:
+			if label, dest, title, n := link(s[i:], st.closingBracket(s, i)-i); n > 0 {
+				flush()
+				b.WriteString(`<a href="` + html.EscapeString(dest) + `"`)
+				if title != "" {
+					b.WriteString(` title="` + html.EscapeString(title) + `"`)
+				}
+				b.WriteString(">")
+				renderSpan(b, label, false)
+				b.WriteString("</a>")
+				i += n
+				continue
+			}
+
+		case c == '<' && links && i >= st.noAutolink:
+			url, n := autolink(s[i:])
+			if n > 0 {
+				flush()
+				b.WriteString(`<a href="` + html.EscapeString(url) + `">` + html.EscapeString(url) + "</a>")
+				i += n
+				continue
+			}
+			// Autolinks starting up to where this one stopped stop there
+			// too.
+			st.noAutolink = i - n
+
+		case c == '*' || c == '_':
+			if tag, inner, n := st.emphasis(s, i); n > 0 {
+				flush()
+				b.WriteString("<" + tag + ">")
+				renderSpan(b, inner, links)
+				b.WriteString("</" + tag + ">")
+				i += n
+				continue
+			}
+			// Skip the whole run so that "**" is not retried as "*".
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], string(c)))
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+}
+
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+// codeSpan parses a code span at the start of s and returns its content and
+// length, or a zero length when the backticks are not closed.
+func codeSpan(s string) (string, int) {
+	open := len(s) - len(strings.TrimLeft(s, "`"))
+	fence := s[:open]
+	for i := open; i < len(s); {
+		j := strings.Index(s[i:], fence)
+		if j < 0 {
+			return "", 0
+		}
+		j += i
+		end := j + open
+		// The closing run must be exactly as long as the opening one.
+		if end < len(s) && s[end] == '`' {
+			i = end + len(s[end:]) - len(strings.TrimLeft(s[end:], "`"))
+			continue
+		}
+		code := strings.ReplaceAll(s[open:j], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		return code, end
+	}
+	return "", 0
+}
+
+// codeSpan is codeSpan for s[i:], remembering runs that are not closed.
+func (st *spanState) codeSpan(s string, i int) (string, int) {
+	open := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+	if from, ok := st.unclosed[open]; ok && i >= from {
+		return "", 0
+	}
+	code, n := codeSpan(s[i:])
+	if n == 0 {
+		st.unclosed[open] = i
+	}
+	return code, n
+}
+
+// closingBracket returns the position of the "]" matching the "[" at s[i],
+// or -1. All brackets of the span are matched in one pass the first time.
+func (st *spanState) closingBracket(s string, i int) int {
+	if st.brackets == nil {
+		st.brackets = make([]int, len(s))
+		var open []int
+		for j := 0; j < len(s); j++ {
+			st.brackets[j] = -1
+			switch s[j] {
+			case '\\':
+				j++
+				if j < len(s) {
+					st.brackets[j] = -1
+				}
+			case '[':
+				open = append(open, j)
+			case ']':
+				if len(open) > 0 {
+					st.brackets[open[len(open)-1]] = j
+					open = open[:len(open)-1]
+				}
+			}
+		}
+	}
+	return st.brackets[i]
+}
+
+// maxLinkParens caps the nesting of parentheses in a link destination, as
+// cmark does. Unclosed destinations that overlap nest deeper and deeper, so
+// the cap also limits how many of them are scanned over the same text.
+const maxLinkParens = 32
+
+// link parses an inline link [label](destination "title") at the start of
+// s, where closing is the position of the "]" matching the "[", or
+// negative. Links to unsafe destinations are not recognised.
+func link(s string, closing int) (label, dest, title string, n int) {
+	if closing < 0 || closing+1 >= len(s) || s[closing+1] != '(' {
+		return "", "", "", 0
+	}
+	label = s[1:closing]
+
+	rest := s[closing+2:]
+	i := len(rest) - len(strings.TrimLeft(rest, " \n"))
+	if i < len(rest) && rest[i] == '<' {
+		// As in CommonMark, the destination cannot hold another "<", which
+		// also stops the scan of an unclosed one at the next.
+		end := strings.IndexAny(rest[i+1:], "<>\n")
+		if end < 0 || rest[i+1+end] != '>' {
+			return "", "", "", 0
+		}
+		dest = rest[i+1 : i+1+end]
+		i += end + 2
+	} else {
+		start, parens := i, 0
+		for ; i < len(rest); i++ {
+			c := rest[i]
+			if c == ' ' || c == '\n' || c < 0x20 {
+				break
+			}
+			if c == '(' {
+				if parens++; parens > maxLinkParens {
+					return "", "", "", 0
+				}
+			} else if c == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		dest = rest[start:i]
+	}
+
+	i += len(rest[i:]) - len(strings.TrimLeft(rest[i:], " \n"))
+	if i < len(rest) && (rest[i] == '"' || rest[i] == '\'') {
+		end := strings.IndexByte(rest[i+1:], rest[i])
+		if end < 0 {
+			return "", "", "", 0
+		}
+		title = rest[i+1 : i+1+end]
+		i += end + 2
+		i += len(rest[i:]) - len(strings.TrimLeft(rest[i:], " \n"))
+	}
+	if i >= len(rest) || rest[i] != ')' {
+		return "", "", "", 0
+	}
+	if !SafeURL(dest) {
+		return "", "", "", 0
+	}
+	return label, dest, title, closing + 2 + i + 1
+}
+
+// autolink parses <http://...> or <https://...> at the start of s. When
+// there is none it returns minus the length it scanned, up to the first
+// space, line break or ">".
+func autolink(s string) (string, int) {
+	end := strings.IndexAny(s, "> \n")
+	if end < 0 {
+		return "", -len(s)
+	}
+	if s[end] != '>' {
+		return "", -end
+	}
+	url := s[1:end]
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", 0
+	}
+	return url, end + 1
+}
+
+// emphasis parses emphasis opening at s[i]. It returns the tag, the inner
+// text and the length consumed, or a zero length if the delimiters do not
+// form emphasis.
+func (st *spanState) emphasis(s string, i int) (tag, inner string, n int) {
+	c := s[i]
+	run := len(s[i:]) - len(strings.TrimLeft(s[i:], string(c)))
+	size := 1
+	tag = "em"
+	if run >= 2 {
+		size, tag = 2, "strong"
+	}
+
+	// The opener must be followed by a non-space, and an underscore must
+	// not sit inside a word.
+	after := i + size
+	if after >= len(s) || isSpace(s[after]) {
+		return "", "", 0
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", "", 0
+	}
+
+	dead := st.dead[delimiter{c, size}]
+	if dead == nil {
+		dead = make([]bool, len(s))
+		st.dead[delimiter{c, size}] = dead
+	}
+	st.visited = st.visited[:0]
+	for j := after + 1; j+size <= len(s) && !dead[j]; j++ {
+		st.visited = append(st.visited, j)
+		if s[j] == '`' {
+			// Delimiters inside code spans do not count.
+			if _, m := st.codeSpan(s, j); m > 0 {
+				j += m - 1
+			}
+			continue
+		}
+		if s[j] != c {
+			continue
+		}
+		r := len(s[j:]) - len(strings.TrimLeft(s[j:], string(c)))
+		// A double delimiter inside plain emphasis belongs to strong
+		// emphasis, a single one inside strong emphasis to plain emphasis.
+		if size == 1 && r >= 2 || r < size || isSpace(s[j-1]) ||
+			c == '_' && j+size < len(s) && isWordByte(s[j+size]) {
+			j += r - 1
+			continue
+		}
+		return tag, s[after:j], j + size - i
+	}
+	for _, j := range st.visited {
+		dead[j] = true
+	}
+	return "", "", 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,236 @@
+// Package markdown renders the subset of CommonMark the forum accepts in
+// posts and comments: paragraphs, headings, emphasis, code spans, fenced
+// code blocks, block quotes, lists and links.
+//
+// Raw HTML in the source is always escaped, and the output is run through
+// Sanitize as well, so the result is safe to embed in a page. Unlike
+// CommonMark, a single line break inside a paragraph is kept as <br>, which
+// is what forum users expect.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Render converts Markdown source to sanitized HTML.
+func Render(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(src, "\n"), false, 0)
+	return Sanitize(b.String())
+}
+
+// maxNesting caps how deep block quotes and lists nest. Every level copies
+// the lines it holds, so without a cap a line of 10000 "> " or "- " markers
+// took quadratic time. Deeper markers are left as text.
+const maxNesting = 16
+
+var (
+	headingRX = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ ]+(.*?))?(?:[ ]+#+)?[ ]*$`)
+	fenceRX   = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ ]*([^`\\s]*)[^`]*$")
+	bulletRX  = regexp.MustCompile(`^( {0,3})([-+*])( +|$)`)
+	orderedRX = regexp.MustCompile(`^( {0,3})(\d{1,9})([.)])( +|$)`)
+	quoteRX   = regexp.MustCompile(`^ {0,3}> ?`)
+	ruleRX    = regexp.MustCompile(`^ {0,3}((\*[ ]*){3,}|(-[ ]*){3,}|(_[ ]*){3,})$`)
+)
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// startsBlock reports whether line begins a block that interrupts a
+// paragraph.
+func startsBlock(line string) bool {
+	if headingRX.MatchString(line) || fenceRX.MatchString(line) || quoteRX.MatchString(line) || ruleRX.MatchString(line) {
+		return true
+	}
+	if m := bulletRX.FindStringSubmatch(line); m != nil && m[3] != "" {
+		return true
+	}
+	if m := orderedRX.FindStringSubmatch(line); m != nil && m[2] == "1" && m[4] != "" {
+		return true
+	}
+	return false
+}
+
+// renderBlocks renders lines as a sequence of blocks. In a tight list item
+// paragraphs are written without <p> tags. depth counts the quotes and
+// lists the lines are nested in.
+func renderBlocks(b *strings.Builder, lines []string, tight bool, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+
+		case fenceRX.MatchString(line):
+			i = renderFence(b, lines, i)
+
+		case headingRX.MatchString(line):
+			m := headingRX.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">")
+			renderInline(b, m[2])
+			b.WriteString("</h" + level + ">\n")
+			i++
+
+		case ruleRX.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+
+		case quoteRX.MatchString(line) && depth < maxNesting:
+			var inner []string
+			for i < len(lines) && quoteRX.MatchString(lines[i]) {
+				inner = append(inner, quoteRX.ReplaceAllString(lines[i], ""))
+				i++
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, inner, false, depth+1)
+			b.WriteString("</blockquote>\n")
+
+		case (bulletRX.MatchString(line) || orderedRX.MatchString(line)) && depth < maxNesting:
+			i = renderList(b, lines, i, depth)
+
+		default:
+			var para []string
+			for i < len(lines) && !isBlank(lines[i]) && (len(para) == 0 || !startsBlock(lines[i])) {
+				para = append(para, strings.TrimSpace(lines[i]))
+				i++
+			}
+			if !tight {
+				b.WriteString("<p>")
+			}
+			renderInline(b, strings.Join(para, "\n"))
+			if !tight {
+				b.WriteString("</p>")
+			}
+			b.WriteString("\n")
+		}
+	}
+}
+
+// renderFence writes the fenced code block starting at lines[i] and returns
+// the index of the first line after it. An unclosed fence runs to the end.
+func renderFence(b *strings.Builder, lines []string, i int) int {
+	m := fenceRX.FindStringSubmatch(lines[i])
+	indent, fence, lang := len(m[1]), m[2], m[3]
+	i++
+
+	b.WriteString("<pre><code")
+	if lang != "" {
+		b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	b.WriteString(">")
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		for n := 0; n < indent && strings.HasPrefix(line, " "); n++ {
+			line = line[1:]
+		}
+		b.WriteString(html.EscapeString(line) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+type listItem struct {
+	lines []string
+}
+
+// listMarker parses a list item marker. It returns the kind of list (the
+// bullet character, or the delimiter of an ordered list), the number an
+// ordered item starts at, the column where the content starts and the
+// content itself.
+func listMarker(line string) (kind string, start int, width int, content string, ok bool) {
+	if m := bulletRX.FindStringSubmatch(line); m != nil {
+		kind, width = m[2], len(m[0])
+	} else if m := orderedRX.FindStringSubmatch(line); m != nil {
+		kind, width = m[3], len(m[0])
+		start, _ = strconv.Atoi(m[2])
+	} else {
+		return "", 0, 0, "", false
+	}
+	content = line[width:]
+	// More than four spaces after the marker start indented content.
+	if spaces := len(line[:width]) - len(strings.TrimRight(line[:width], " ")); spaces > 4 {
+		width -= spaces - 1
+		content = line[width:]
+	}
+	if isBlank(content) {
+		width = len(strings.TrimRight(line, " ")) + 1
+	}
+	return kind, start, width, content, true
+}
+
+// renderList writes the list starting at lines[i] and returns the index of
+// the first line after it.
+func renderList(b *strings.Builder, lines []string, i int, depth int) int {
+	kind, start, width, content, _ := listMarker(lines[i])
+	ordered := kind == "." || kind == ")"
+
+	items := []*listItem{{lines: []string{content}}}
+	loose := false
+	blank := false
+	i++
+	for i < len(lines) {
+		line := lines[i]
+		if isBlank(line) {
+			blank = true
+			items[len(items)-1].lines = append(items[len(items)-1].lines, "")
+			i++
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent >= width {
+			if blank {
+				loose = loose || len(strings.TrimSpace(strings.Join(items[len(items)-1].lines, ""))) > 0
+			}
+			items[len(items)-1].lines = append(items[len(items)-1].lines, line[width:])
+			blank = false
+			i++
+			continue
+		}
+		if k, _, w, c, ok := listMarker(line); ok && k == kind {
+			if blank {
+				loose = true
+			}
+			items = append(items, &listItem{lines: []string{c}})
+			width = w
+			blank = false
+			i++
+			continue
+		}
+		// A lazy continuation line extends the paragraph of the last item.
+		if !blank && !startsBlock(line) {
+			items[len(items)-1].lines = append(items[len(items)-1].lines, line)
+			i++
+			continue
+		}
+		break
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if ordered && start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		renderBlocks(b, item.lines, !loose, depth+1)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
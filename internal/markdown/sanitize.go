@@ -0,0 +1,162 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// allowed lists the elements Sanitize keeps and, for each, the attributes
+// they may carry.
+var allowed = map[string][]string{
+	"a":          {"href", "title"},
+	"blockquote": nil,
+	"br":         nil,
+	"code":       {"class"},
+	"em":         nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"li":         nil,
+	"ol":         {"start"},
+	"p":          nil,
+	"pre":        nil,
+	"strong":     nil,
+	"ul":         nil,
+}
+
+var voidElements = map[string]bool{"br": true, "hr": true}
+
+// Elements whose content is dropped along with the tags.
+var dropContent = map[string]bool{"script": true, "style": true, "iframe": true, "object": true, "template": true}
+
+var (
+	languageRX = regexp.MustCompile(`^language-[A-Za-z0-9_+-]+$`)
+	numberRX   = regexp.MustCompile(`^[0-9]{1,9}$`)
+)
+
+// Sanitize keeps only allow-listed elements and attributes of the HTML
+// fragment s. Other tags are removed but their text is kept, escaped. Links
+// must have a safe destination and get rel="nofollow noopener". Open
+// elements are closed at the end, so the result never leaks markup into the
+// surrounding page.
+func Sanitize(s string) string {
+	var b strings.Builder
+	var open []string
+	skip := 0
+
+	z := xhtml.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		switch tt {
+		case xhtml.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(tok.Data))
+			}
+
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if dropContent[tok.Data] {
+				if tt == xhtml.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			attrs, ok := allowed[tok.Data]
+			if !ok || skip > 0 {
+				continue
+			}
+			b.WriteString("<" + tok.Data)
+			for _, a := range tok.Attr {
+				if a.Namespace != "" || !contains(attrs, a.Key) || !safeAttr(tok.Data, a.Key, a.Val) {
+					continue
+				}
+				b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+			}
+			if tok.Data == "a" {
+				b.WriteString(` rel="nofollow noopener"`)
+			}
+			b.WriteString(">")
+			if !voidElements[tok.Data] {
+				open = append(open, tok.Data)
+			}
+
+		case xhtml.EndTagToken:
+			if dropContent[tok.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			// Close up to the matching open element, ignore stray end tags.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tok.Data {
+					for j := len(open) - 1; j >= i; j-- {
+						b.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+func safeAttr(tag, key, val string) bool {
+	switch {
+	case key == "href":
+		return SafeURL(val)
+	case tag == "code" && key == "class":
+		return languageRX.MatchString(val)
+	case tag == "ol" && key == "start":
+		return numberRX.MatchString(val)
+	}
+	return true
+}
+
+// SafeURL reports whether u may be used as a link: http, https and mailto
+// URLs, and relative references. Entities are decoded first, so the answer
+// holds whether or not the caller already did.
+func SafeURL(u string) bool {
+	u = strings.TrimSpace(html.UnescapeString(u))
+	if u == "" {
+		return false
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	case "":
+		// Reject anything a browser could still read as a scheme, or as
+		// another host: browsers treat backslashes like slashes.
+		return !strings.ContainsAny(strings.SplitN(u, "/", 2)[0], ":\\") &&
+			!strings.HasPrefix(strings.ReplaceAll(u, "\\", "/"), "//")
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
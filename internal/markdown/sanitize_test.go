@@ -0,0 +1,185 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.com", true},
+		{"https://example.com/a?b=c#d", true},
+		{"HTTPS://EXAMPLE.COM", true},
+		{"mailto:alice@example.com", true},
+		{"/post/view/1", true},
+		{"post/view/1", true},
+		{"#comment-3", true},
+		{"?page=2", true},
+		{"  https://example.com  ", true},
+
+		{"", false},
+		{"   ", false},
+		{"javascript:alert(1)", false},
+		{"JaVaScRiPt:alert(1)", false},
+		{" javascript:alert(1)", false},
+		{"java\tscript:alert(1)", false},
+		{"java\nscript:alert(1)", false},
+		{"\x01javascript:alert(1)", false},
+		{"&#106;avascript:alert(1)", false},
+		{"javascript&#58;alert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"DATA:text/html;base64,PHNjcmlwdD4=", false},
+		{"vbscript:msgbox(1)", false},
+		{"VBScript:msgbox(1)", false},
+		{"file:///etc/passwd", false},
+		{"ftp://example.com", false},
+		{"//evil.com", false},
+		{"//evil.com/path", false},
+		{"\\\\evil.com", false},
+		{"/\\evil.com", false},
+		{"\\/evil.com", false},
+		{"\\evil.com", false},
+		{"evil.com\\@good.com", false},
+		{"a:b", false},
+	}
+	for _, tt := range tests {
+		if got := SafeURL(tt.url); got != tt.want {
+			t.Errorf("SafeURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"allowed markup", "<p><em>a</em> <strong>b</strong></p>", "<p><em>a</em> <strong>b</strong></p>"},
+		{"unknown tags keep their text", "<div><span>a</span></div>", "a"},
+		{"script content", "a<script>alert(1)</script>b", "ab"},
+		{"style content", "a<style>p { color: red }</style>b", "ab"},
+		{"iframe content", "a<iframe>x</iframe>b", "ab"},
+		{"unclosed script", "a<script>alert(1)", "a"},
+		{"split script tag", "<scr<script>ipt>alert(1)</script>", "ipt&gt;alert(1)"},
+		{"uppercase script", "<SCRIPT>alert(1)</SCRIPT>ok", "ok"},
+		{"unclosed tags", "<p><em>a", "<p><em>a</em></p>"},
+		{"misnested tags", "<em><strong>a</em>b</strong>", "<em><strong>a</strong></em>b"},
+		{"stray end tag", "a</em>b", "ab"},
+		{"nested lists", "<ul><li><ol start=\"3\"><li>a</li></ol></li></ul>", "<ul><li><ol start=\"3\"><li>a</li></ol></li></ul>"},
+		{"bad list start", `<ol start="1; x">`, "<ol></ol>"},
+		{"event handlers", `<p onclick="alert(1)">a</p>`, "<p>a</p>"},
+		{"code language", `<code class="language-go">x</code>`, `<code class="language-go">x</code>`},
+		{"bad code class", `<code class="x&quot; onclick=&quot;y">x</code>`, "<code>x</code>"},
+		{"safe link", `<a href="/x" title="t">l</a>`, `<a href="/x" title="t" rel="nofollow noopener">l</a>`},
+		{"javascript link", `<a href="javascript:alert(1)">l</a>`, `<a rel="nofollow noopener">l</a>`},
+		{"entity encoded scheme", `<a href="&#106;avascript:alert(1)">l</a>`, `<a rel="nofollow noopener">l</a>`},
+		{"entity encoded tab", `<a href="jav&#x09;ascript:alert(1)">l</a>`, `<a rel="nofollow noopener">l</a>`},
+		{"data link", `<a href="data:text/html,x">l</a>`, `<a rel="nofollow noopener">l</a>`},
+		{"vbscript link", `<a href="vbscript:x">l</a>`, `<a rel="nofollow noopener">l</a>`},
+		{"protocol relative link", `<a href="//evil.com">l</a>`, `<a rel="nofollow noopener">l</a>`},
+		{"backslash link", `<a href="/\evil.com">l</a>`, `<a rel="nofollow noopener">l</a>`},
+		{"title with quotes", `<a href="/x" title='a"b'>l</a>`, `<a href="/x" title="a&#34;b" rel="nofollow noopener">l</a>`},
+		{"text is escaped", "a &lt;b&gt; &amp; c", "a &lt;b&gt; &amp; c"},
+		{"comments are dropped", "a<!-- <script> -->b", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"emphasis", "*a* **b** _c_", "<p><em>a</em> <strong>b</strong> <em>c</em></p>\n"},
+		{"unclosed emphasis", "*a **b _c", "<p>*a **b _c</p>\n"},
+		{"code keeps delimiters", "`*a*` *b*", "<p><code>*a*</code> <em>b</em></p>\n"},
+		{"raw html is text", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"link", "[a](https://example.com)", `<p><a href="https://example.com" rel="nofollow noopener">a</a></p>` + "\n"},
+		{"javascript link", "[a](javascript:alert(1))", "<p>[a](javascript:alert(1))</p>\n"},
+		{"mixed case scheme", "[a](JaVaScRiPt:alert(1))", "<p>[a](JaVaScRiPt:alert(1))</p>\n"},
+		{"entity encoded scheme", "[a](&#106;avascript:alert(1))", "<p>[a](&amp;#106;avascript:alert(1))</p>\n"},
+		{"data link", "[a](data:text/html,x)", "<p>[a](data:text/html,x)</p>\n"},
+		{"protocol relative link", "[a](//evil.com)", "<p>[a](//evil.com)</p>\n"},
+		{"backslash link", `[a](/\evil.com)`, `<p>[a](/\evil.com)</p>` + "\n"},
+		{"title with double quotes", `[a](/x 'say "hi"')`, `<p><a href="/x" title="say &#34;hi&#34;" rel="nofollow noopener">a</a></p>` + "\n"},
+		{"title with single quotes", `[a](/x "it's")`, `<p><a href="/x" title="it&#39;s" rel="nofollow noopener">a</a></p>` + "\n"},
+		{"title with markup", `[a](/x "<b>&")`, `<p><a href="/x" title="&lt;b&gt;&amp;" rel="nofollow noopener">a</a></p>` + "\n"},
+		{"autolink", "<https://example.com>", `<p><a href="https://example.com" rel="nofollow noopener">https://example.com</a></p>` + "\n"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.in); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// Each of these inputs used to take time quadratic in its length, seconds
+// for a post of this size. Every one renders in milliseconds now, so the
+// bound leaves plenty of room for slow and instrumented builds.
+func TestRenderPathological(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"unclosed emphasis", strings.Repeat("*a ", 40000)},
+		{"unclosed underscores", strings.Repeat("_a ", 40000)},
+		{"unclosed strong and code", strings.Repeat("**a `", 30000)},
+		{"unclosed code and emphasis", strings.Repeat("`` *a ", 20000)},
+		{"backticks", strings.Repeat("`", 100000)},
+		{"open brackets", strings.Repeat("[", 100000)},
+		{"open brackets with text", strings.Repeat("[a", 50000)},
+		{"unclosed destinations", strings.Repeat("[](", 40000)},
+		{"unclosed pointy destinations", strings.Repeat("[](<", 25000)},
+		{"unclosed titles", strings.Repeat(`[](a "`, 20000)},
+		{"unclosed autolinks", strings.Repeat("<http://", 15000)},
+		{"nested quotes", strings.Repeat(">", 100000)},
+		{"nested quote lines", strings.Repeat(strings.Repeat(">", 500)+"\n", 200)},
+		{"nested lists", strings.Repeat("- ", 50000) + "x"},
+		{"nested ordered lists", strings.Repeat("1. ", 35000) + "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			got := Render(tt.in)
+			if took := time.Since(start); took > time.Second {
+				t.Errorf("rendering %d bytes took %v", len(tt.in), took)
+			}
+			if got == "" {
+				t.Error("nothing was rendered")
+			}
+		})
+	}
+}
+
+func TestRenderNestingDepth(t *testing.T) {
+	got := Render(strings.Repeat("> ", maxNesting+5) + "a")
+	if n := strings.Count(got, "<blockquote>"); n != maxNesting {
+		t.Errorf("%d nested quotes, want %d", n, maxNesting)
+	}
+	got = Render(strings.Repeat("- ", maxNesting+5) + "a")
+	if n := strings.Count(got, "<ul>"); n != maxNesting {
+		t.Errorf("%d nested lists, want %d", n, maxNesting)
+	}
+}
+
+func BenchmarkRenderBrackets(b *testing.B) {
+	s := strings.Repeat("[a](", 5000)
+	for i := 0; i < b.N; i++ {
+		Render(s)
+	}
+}
@@ -0,0 +1,126 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+
+	"dyelesho/forum/internal/dbs"
+)
+
+// Data migrations that are written in Go because plain SQL differs too much
+// between dialects. They only use "?" placeholders and portable SQL.
+
+var defaultCategories = []string{"Technology", "Travel", "Health", "Entertainment"}
+
+// splitPostCategories moves the space-joined posts.category strings into the
+// categories and post_categories tables.
+func splitPostCategories(tx *dbs.Tx) error {
+	for _, name := range defaultCategories {
+		if _, err := tx.Exec(`INSERT INTO categories (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, name); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT id, category FROM posts`)
+	if err != nil {
+		return err
+	}
+	type post struct {
+		id       int
+		category string
+	}
+	var posts []post
+	for rows.Next() {
+		var p post
+		if err = rows.Scan(&p.id, &p.category); err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		for _, name := range strings.Fields(p.category) {
+			if _, err = tx.Exec(`INSERT INTO categories (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, name); err != nil {
+				return err
+			}
+			stmt := `INSERT INTO post_categories (post_id, category_id)
+				SELECT ?, id FROM categories WHERE name = ?
+				ON CONFLICT (post_id, category_id) DO NOTHING`
+			if _, err = tx.Exec(stmt, p.id, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// joinPostCategories is the reverse of splitPostCategories. It expects an
+// empty posts.category column to fill in.
+func joinPostCategories(tx *dbs.Tx) error {
+	stmt := `SELECT pc.post_id, c.name FROM post_categories pc
+		INNER JOIN categories c ON c.id = pc.category_id
+		ORDER BY pc.post_id, c.name`
+	rows, err := tx.Query(stmt)
+	if err != nil {
+		return err
+	}
+	names := map[int][]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		names[id] = append(names[id], name)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, list := range names {
+		if _, err = tx.Exec(`UPDATE posts SET category = ? WHERE id = ?`, strings.Join(list, " "), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashSessionTokens replaces the tokens in sessions.token_hash, which still
+// hold the raw cookie values, with their SHA-256 hex digests.
+func hashSessionTokens(tx *dbs.Tx) error {
+	rows, err := tx.Query(`SELECT session_id, token_hash FROM sessions WHERE token_hash IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	tokens := map[int]string{}
+	for rows.Next() {
+		var id int
+		var token sql.NullString
+		if err = rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens[id] = token.String
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, token := range tokens {
+		sum := sha256.Sum256([]byte(token))
+		if _, err = tx.Exec(`UPDATE sessions SET token_hash = ? WHERE session_id = ?`, hex.EncodeToString(sum[:]), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
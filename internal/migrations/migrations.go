@@ -0,0 +1,232 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"dyelesho/forum/internal/dbs"
+)
+
+var ErrNoApplied = errors.New("migrations: no applied migrations to roll back")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *dbs.Tx) error
+	Down    func(tx *dbs.Tx) error
+}
+
+// Status describes a migration. NeedsFTS5 is set when it is pending
+// because SQLite lacks FTS5.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	NeedsFTS5 bool
+}
+
+type Migrator struct {
+	DB         *dbs.DB
+	Migrations []Migration
+}
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);`
+
+// For returns the migrations written for the given dialect.
+func For(dialect dbs.Dialect) []Migration {
+	if dialect == dbs.Postgres {
+		return Postgres
+	}
+	return SQLite
+}
+
+// Exec returns a migration step that runs the given statements in order.
+func Exec(stmts ...string) func(tx *dbs.Tx) error {
+	return func(tx *dbs.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// steps runs several migration steps in order.
+func steps(fns ...func(tx *dbs.Tx) error) func(tx *dbs.Tx) error {
+	return func(tx *dbs.Tx) error {
+		for _, fn := range fns {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// unlessTable runs step only when SQLite has no table called name yet.
+func unlessTable(name string, step func(tx *dbs.Tx) error) func(tx *dbs.Tx) error {
+	return func(tx *dbs.Tx) error {
+		var n int
+		err := tx.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n)
+		if err != nil || n > 0 {
+			return err
+		}
+		return step(tx)
+	}
+}
+
+// skipped reports whether mig needs FTS5 and the SQLite of m.DB lacks it.
+// Up leaves such migrations pending; see needsFTS5.
+func (m *Migrator) skipped(mig Migration) bool {
+	return m.DB.Dialect == dbs.SQLite && !m.DB.FTS5 && needsFTS5[mig.Version]
+}
+
+func (m *Migrator) sorted() ([]Migration, error) {
+	list := make([]Migration, len(m.Migrations))
+	copy(list, m.Migrations)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			return nil, fmt.Errorf("migrations: duplicate version %d", list[i].Version)
+		}
+	}
+	return list, nil
+}
+
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if _, err := m.DB.Exec(createSchemaMigrations); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Up applies every pending migration in version order and returns the
+// migrations that were applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	list, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range list {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if m.skipped(mig) {
+			continue
+		}
+		err = m.run(mig.Up, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			mig.Version, mig.Name, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migrations: up %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down() (Migration, error) {
+	list, err := m.sorted()
+	if err != nil {
+		return Migration{}, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return Migration{}, err
+	}
+
+	for i := len(list) - 1; i >= 0; i-- {
+		mig := list[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == nil {
+			return mig, fmt.Errorf("migrations: %d_%s cannot be rolled back", mig.Version, mig.Name)
+		}
+		down := mig.Down
+		if m.skipped(mig) {
+			down = nil
+		}
+		err = m.run(down, `DELETE FROM schema_migrations WHERE version = ?`, mig.Version)
+		if err != nil {
+			return mig, fmt.Errorf("migrations: down %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		return mig, nil
+	}
+	return Migration{}, ErrNoApplied
+}
+
+func (m *Migrator) run(step func(tx *dbs.Tx) error, record string, args ...any) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if step != nil {
+		if err = step(tx); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	list, err := m.sorted()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(list))
+	for _, mig := range list {
+		at, ok := applied[mig.Version]
+		statuses = append(statuses, Status{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Applied:   ok,
+			AppliedAt: at,
+			NeedsFTS5: !ok && m.skipped(mig),
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,354 @@
+package migrations
+
+// Postgres mirrors SQLite version for version. Column names are left
+// unquoted so they fold to lower case and match the queries in models.
+var Postgres = []Migration{
+	{
+		Version: 1,
+		Name:    "create_initial_tables",
+		Up: Exec(
+			`CREATE TABLE IF NOT EXISTS posts (
+				id SERIAL PRIMARY KEY,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				created TIMESTAMPTZ NOT NULL,
+				category TEXT NOT NULL,
+				user_name TEXT NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_posts_created ON posts(created);`,
+			`CREATE TABLE IF NOT EXISTS users (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				email TEXT NOT NULL,
+				hashed_password CHAR(60) NOT NULL,
+				created TIMESTAMPTZ NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS comments (
+				id SERIAL PRIMARY KEY,
+				ccontent TEXT,
+				author TEXT,
+				postid INTEGER
+			);`,
+			`CREATE TABLE IF NOT EXISTS sessions (
+				session_id SERIAL PRIMARY KEY,
+				user_name TEXT,
+				user_id INTEGER,
+				token TEXT UNIQUE,
+				expiration_date TIMESTAMPTZ
+			);`,
+			`CREATE TABLE IF NOT EXISTS post_reactions (
+				user_id INTEGER,
+				post_id INTEGER,
+				"like" INTEGER,
+				dislike INTEGER
+			);`,
+			`CREATE TABLE IF NOT EXISTS comment_reactions (
+				user_id INTEGER,
+				comment_id INTEGER,
+				"like" INTEGER,
+				dislike INTEGER
+			);`,
+		),
+		Down: Exec(
+			`DROP TABLE IF EXISTS comment_reactions;`,
+			`DROP TABLE IF EXISTS post_reactions;`,
+			`DROP TABLE IF EXISTS sessions;`,
+			`DROP TABLE IF EXISTS comments;`,
+			`DROP TABLE IF EXISTS users;`,
+			`DROP TABLE IF EXISTS posts;`,
+		),
+	},
+	{
+		Version: 2,
+		Name:    "create_post_revisions",
+		Up: Exec(
+			`ALTER TABLE posts ADD COLUMN updated TIMESTAMPTZ;`,
+			`CREATE TABLE post_revisions (
+				id SERIAL PRIMARY KEY,
+				post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				category TEXT NOT NULL,
+				edited TIMESTAMPTZ NOT NULL
+			);`,
+			`CREATE INDEX idx_post_revisions_post ON post_revisions(post_id, id);`,
+		),
+		Down: Exec(
+			`DROP TABLE post_revisions;`,
+			`ALTER TABLE posts DROP COLUMN updated;`,
+		),
+	},
+	{
+		Version: 3,
+		Name:    "add_comment_edit_markers",
+		Up: Exec(
+			`ALTER TABLE comments ADD COLUMN edited_at TIMESTAMPTZ;`,
+			`ALTER TABLE comments ADD COLUMN deleted_at TIMESTAMPTZ;`,
+		),
+		Down: Exec(
+			`ALTER TABLE comments DROP COLUMN deleted_at;`,
+			`ALTER TABLE comments DROP COLUMN edited_at;`,
+		),
+	},
+	{
+		Version: 4,
+		Name:    "add_comment_parent",
+		Up: Exec(
+			`ALTER TABLE comments ADD COLUMN parent_id INTEGER REFERENCES comments(id);`,
+			`CREATE INDEX idx_comments_post ON comments(postid, parent_id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_comments_post;`,
+			`ALTER TABLE comments DROP COLUMN parent_id;`,
+		),
+	},
+	{
+		Version: 5,
+		Name:    "normalize_categories",
+		Up: steps(
+			Exec(
+				`CREATE TABLE categories (
+					id SERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE
+				);`,
+				`CREATE TABLE post_categories (
+					post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+					category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+					PRIMARY KEY (post_id, category_id)
+				);`,
+				`CREATE INDEX idx_post_categories_category ON post_categories(category_id, post_id);`,
+			),
+			splitPostCategories,
+			Exec(`ALTER TABLE posts DROP COLUMN category;`),
+		),
+		Down: steps(
+			Exec(`ALTER TABLE posts ADD COLUMN category TEXT NOT NULL DEFAULT '';`),
+			joinPostCategories,
+			Exec(
+				`DROP TABLE post_categories;`,
+				`DROP TABLE categories;`,
+			),
+		),
+	},
+	{
+		Version: 6,
+		Name:    "add_user_roles",
+		Up:      Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';`),
+		Down:    Exec(`ALTER TABLE users DROP COLUMN role;`),
+	},
+	{
+		Version: 7,
+		Name:    "add_posts_listing_index",
+		Up: Exec(
+			`DROP INDEX idx_posts_created;`,
+			`CREATE INDEX idx_posts_created ON posts(created, id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_posts_created;`,
+			`CREATE INDEX idx_posts_created ON posts(created);`,
+		),
+	},
+	{
+		Version: 8,
+		Name:    "add_search_index",
+		Up: Exec(
+			`ALTER TABLE posts ADD COLUMN search tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', content), 'B')
+			) STORED;`,
+			`CREATE INDEX idx_posts_search ON posts USING GIN (search);`,
+			`ALTER TABLE comments ADD COLUMN search tsvector GENERATED ALWAYS AS (
+				to_tsvector('english', coalesce(ccontent, ''))
+			) STORED;`,
+			`CREATE INDEX idx_comments_search ON comments USING GIN (search);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_comments_search;`,
+			`ALTER TABLE comments DROP COLUMN search;`,
+			`DROP INDEX idx_posts_search;`,
+			`ALTER TABLE posts DROP COLUMN search;`,
+		),
+	},
+	{
+		Version: 9,
+		Name:    "convert_comment_breaks",
+		Up:      Exec(`UPDATE comments SET ccontent = REPLACE(ccontent, '<br>', chr(10)) WHERE ccontent LIKE '%<br>%';`),
+		Down:    Exec(`UPDATE comments SET ccontent = REPLACE(ccontent, chr(10), '<br>') WHERE ccontent LIKE '%' || chr(10) || '%';`),
+	},
+	{
+		Version: 10,
+		Name:    "create_attachments",
+		Up: Exec(
+			`CREATE TABLE attachments (
+				id SERIAL PRIMARY KEY,
+				post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size BIGINT NOT NULL,
+				file_key TEXT NOT NULL UNIQUE,
+				thumb_key TEXT NOT NULL DEFAULT '',
+				created TIMESTAMPTZ NOT NULL
+			);`,
+			`CREATE INDEX idx_attachments_post ON attachments(post_id, id);`,
+		),
+		Down: Exec(`DROP TABLE attachments;`),
+	},
+	{
+		Version: 11,
+		Name:    "add_unique_reactions",
+		Up: Exec(
+			`DELETE FROM post_reactions a USING post_reactions b
+				WHERE a.user_id = b.user_id AND a.post_id = b.post_id AND a.ctid < b.ctid;`,
+			`DELETE FROM comment_reactions a USING comment_reactions b
+				WHERE a.user_id = b.user_id AND a.comment_id = b.comment_id AND a.ctid < b.ctid;`,
+			`DELETE FROM post_reactions WHERE COALESCE("like", 0) = 0 AND COALESCE(dislike, 0) = 0;`,
+			`DELETE FROM comment_reactions WHERE COALESCE("like", 0) = 0 AND COALESCE(dislike, 0) = 0;`,
+			`CREATE UNIQUE INDEX idx_post_reactions_user_post ON post_reactions(user_id, post_id);`,
+			`CREATE UNIQUE INDEX idx_comment_reactions_user_comment ON comment_reactions(user_id, comment_id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_comment_reactions_user_comment;`,
+			`DROP INDEX idx_post_reactions_user_post;`,
+		),
+	},
+	{
+		Version: 12,
+		Name:    "add_reaction_kinds",
+		Up: Exec(
+			`CREATE TABLE post_reactions_new (
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				kind TEXT NOT NULL,
+				created TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (user_id, post_id)
+			);`,
+			`INSERT INTO post_reactions_new (user_id, post_id, kind, created)
+				SELECT user_id, post_id, CASE WHEN "like" = 1 THEN 'like' ELSE 'dislike' END, now()
+				FROM post_reactions
+				WHERE ("like" = 1 OR dislike = 1)
+					AND user_id IN (SELECT id FROM users) AND post_id IN (SELECT id FROM posts);`,
+			`DROP TABLE post_reactions;`,
+			`ALTER TABLE post_reactions_new RENAME TO post_reactions;`,
+			`CREATE INDEX idx_post_reactions_post ON post_reactions(post_id, kind);`,
+			`CREATE TABLE comment_reactions_new (
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+				kind TEXT NOT NULL,
+				created TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (user_id, comment_id)
+			);`,
+			`INSERT INTO comment_reactions_new (user_id, comment_id, kind, created)
+				SELECT user_id, comment_id, CASE WHEN "like" = 1 THEN 'like' ELSE 'dislike' END, now()
+				FROM comment_reactions
+				WHERE ("like" = 1 OR dislike = 1)
+					AND user_id IN (SELECT id FROM users) AND comment_id IN (SELECT id FROM comments);`,
+			`DROP TABLE comment_reactions;`,
+			`ALTER TABLE comment_reactions_new RENAME TO comment_reactions;`,
+			`CREATE INDEX idx_comment_reactions_comment ON comment_reactions(comment_id, kind);`,
+		),
+		Down: Exec(
+			`CREATE TABLE post_reactions_old (
+				user_id INTEGER,
+				post_id INTEGER,
+				"like" INTEGER,
+				dislike INTEGER
+			);`,
+			`INSERT INTO post_reactions_old (user_id, post_id, "like", dislike)
+				SELECT user_id, post_id, CASE WHEN kind = 'like' THEN 1 ELSE 0 END, CASE WHEN kind = 'dislike' THEN 1 ELSE 0 END
+				FROM post_reactions WHERE kind IN ('like', 'dislike');`,
+			`DROP TABLE post_reactions;`,
+			`ALTER TABLE post_reactions_old RENAME TO post_reactions;`,
+			`CREATE UNIQUE INDEX idx_post_reactions_user_post ON post_reactions(user_id, post_id);`,
+			`CREATE TABLE comment_reactions_old (
+				user_id INTEGER,
+				comment_id INTEGER,
+				"like" INTEGER,
+				dislike INTEGER
+			);`,
+			`INSERT INTO comment_reactions_old (user_id, comment_id, "like", dislike)
+				SELECT user_id, comment_id, CASE WHEN kind = 'like' THEN 1 ELSE 0 END, CASE WHEN kind = 'dislike' THEN 1 ELSE 0 END
+				FROM comment_reactions WHERE kind IN ('like', 'dislike');`,
+			`DROP TABLE comment_reactions;`,
+			`ALTER TABLE comment_reactions_old RENAME TO comment_reactions;`,
+			`CREATE UNIQUE INDEX idx_comment_reactions_user_comment ON comment_reactions(user_id, comment_id);`,
+		),
+	},
+	{
+		Version: 13,
+		Name:    "add_counters",
+		Up: Exec(
+			`ALTER TABLE posts ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE posts ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE posts ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE comments ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE comments ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;`,
+			`UPDATE posts SET
+				like_count = (SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = posts.id AND r.kind = 'like'),
+				dislike_count = (SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = posts.id AND r.kind = 'dislike'),
+				comment_count = (SELECT COUNT(*) FROM comments c WHERE c.postid = posts.id AND c.deleted_at IS NULL);`,
+			`UPDATE comments SET
+				like_count = (SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = comments.id AND r.kind = 'like'),
+				dislike_count = (SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = comments.id AND r.kind = 'dislike');`,
+			`CREATE INDEX idx_posts_net_likes ON posts ((like_count - dislike_count), created, id);`,
+			`CREATE INDEX idx_posts_comment_count ON posts (comment_count, created, id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_posts_comment_count;`,
+			`DROP INDEX idx_posts_net_likes;`,
+			`ALTER TABLE comments DROP COLUMN dislike_count;`,
+			`ALTER TABLE comments DROP COLUMN like_count;`,
+			`ALTER TABLE posts DROP COLUMN comment_count;`,
+			`ALTER TABLE posts DROP COLUMN dislike_count;`,
+			`ALTER TABLE posts DROP COLUMN like_count;`,
+		),
+	},
+	{
+		Version: 14,
+		Name:    "hash_session_tokens",
+		Up: steps(
+			Exec(
+				`ALTER TABLE sessions RENAME COLUMN token TO token_hash;`,
+				`ALTER TABLE sessions ADD COLUMN remember BOOLEAN NOT NULL DEFAULT false;`,
+			),
+			hashSessionTokens,
+		),
+		// The tokens cannot be recovered from their hashes, so rolling back
+		// signs everyone out.
+		Down: Exec(
+			`DELETE FROM sessions;`,
+			`ALTER TABLE sessions DROP COLUMN remember;`,
+			`ALTER TABLE sessions RENAME COLUMN token_hash TO token;`,
+		),
+	},
+	{
+		Version: 15,
+		Name:    "add_session_details",
+		Up: Exec(
+			`ALTER TABLE sessions ADD COLUMN created TIMESTAMPTZ;`,
+			`ALTER TABLE sessions ADD COLUMN last_seen TIMESTAMPTZ;`,
+			`ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';`,
+			`CREATE INDEX idx_sessions_user ON sessions(user_id, last_seen);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_sessions_user;`,
+			`ALTER TABLE sessions DROP COLUMN user_agent;`,
+			`ALTER TABLE sessions DROP COLUMN ip;`,
+			`ALTER TABLE sessions DROP COLUMN last_seen;`,
+			`ALTER TABLE sessions DROP COLUMN created;`,
+		),
+	},
+	{
+		// Only SQLite stored timestamps as text in two formats.
+		Version: 16,
+		Name:    "normalize_timestamps",
+		Up:      Exec(),
+		Down:    Exec(),
+	},
+	{
+		// Only SQLite can lack its search index.
+		Version: 17,
+		Name:    "create_missing_search_index",
+		Up:      Exec(),
+		Down:    Exec(),
+	},
+}
@@ -0,0 +1,430 @@
+package migrations
+
+// SQLite lists the schema changes in the order they are applied. New entries
+// must use the next free version, never modify an applied migration, and
+// have a counterpart with the same version in Postgres.
+var SQLite = []Migration{
+	{
+		Version: 1,
+		Name:    "create_initial_tables",
+		Up: Exec(
+			`CREATE TABLE IF NOT EXISTS posts (
+				id INTEGER PRIMARY KEY,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				created DATETIME NOT NULL,
+				category TEXT NOT NULL,
+				user_name TEXT NOT NULL
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_posts_created ON posts(created);`,
+			`CREATE TABLE IF NOT EXISTS Users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				email TEXT NOT NULL,
+				hashed_password CHAR(60) NOT NULL,
+				created DATETIME NOT NULL
+			);`,
+			`CREATE TABLE IF NOT EXISTS comments (
+				"Id"	INTEGER PRIMARY KEY AUTOINCREMENT,
+				"CContent"	TEXT,
+				"Author"	TEXT,
+				"PostID" INTEGER
+			);`,
+			`CREATE TABLE IF NOT EXISTS Sessions (
+				session_id INTEGER PRIMARY KEY,
+				user_name TEXT,
+				user_id INTEGER,
+				token TEXT UNIQUE,
+				expiration_date TIMESTAMP
+			);`,
+			`CREATE TABLE IF NOT EXISTS post_reactions (
+				user_id INTEGER,
+				post_id INTEGER,
+				like INTEGER,
+				dislike INTEGER
+			);`,
+			`CREATE TABLE IF NOT EXISTS comment_reactions (
+				user_id INTEGER,
+				comment_id INTEGER,
+				like INTEGER,
+				dislike INTEGER
+			);`,
+		),
+		Down: Exec(
+			`DROP TABLE IF EXISTS comment_reactions;`,
+			`DROP TABLE IF EXISTS post_reactions;`,
+			`DROP TABLE IF EXISTS Sessions;`,
+			`DROP TABLE IF EXISTS comments;`,
+			`DROP TABLE IF EXISTS Users;`,
+			`DROP TABLE IF EXISTS posts;`,
+		),
+	},
+	{
+		Version: 2,
+		Name:    "create_post_revisions",
+		Up: Exec(
+			`ALTER TABLE posts ADD COLUMN updated DATETIME;`,
+			`CREATE TABLE post_revisions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				title TEXT NOT NULL,
+				content TEXT NOT NULL,
+				category TEXT NOT NULL,
+				edited DATETIME NOT NULL
+			);`,
+			`CREATE INDEX idx_post_revisions_post ON post_revisions(post_id, id);`,
+		),
+		Down: Exec(
+			`DROP TABLE post_revisions;`,
+			`ALTER TABLE posts DROP COLUMN updated;`,
+		),
+	},
+	{
+		Version: 3,
+		Name:    "add_comment_edit_markers",
+		Up: Exec(
+			`ALTER TABLE comments ADD COLUMN edited_at DATETIME;`,
+			`ALTER TABLE comments ADD COLUMN deleted_at DATETIME;`,
+		),
+		Down: Exec(
+			`ALTER TABLE comments DROP COLUMN deleted_at;`,
+			`ALTER TABLE comments DROP COLUMN edited_at;`,
+		),
+	},
+	{
+		Version: 4,
+		Name:    "add_comment_parent",
+		Up: Exec(
+			`ALTER TABLE comments ADD COLUMN parent_id INTEGER REFERENCES comments(Id);`,
+			`CREATE INDEX idx_comments_post ON comments(PostID, parent_id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_comments_post;`,
+			`ALTER TABLE comments DROP COLUMN parent_id;`,
+		),
+	},
+	{
+		Version: 5,
+		Name:    "normalize_categories",
+		Up: steps(
+			Exec(
+				`CREATE TABLE categories (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE
+				);`,
+				`CREATE TABLE post_categories (
+					post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+					category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+					PRIMARY KEY (post_id, category_id)
+				);`,
+				`CREATE INDEX idx_post_categories_category ON post_categories(category_id, post_id);`,
+			),
+			splitPostCategories,
+			Exec(`ALTER TABLE posts DROP COLUMN category;`),
+		),
+		Down: steps(
+			Exec(`ALTER TABLE posts ADD COLUMN category TEXT NOT NULL DEFAULT '';`),
+			joinPostCategories,
+			Exec(
+				`DROP TABLE post_categories;`,
+				`DROP TABLE categories;`,
+			),
+		),
+	},
+	{
+		Version: 6,
+		Name:    "add_user_roles",
+		Up:      Exec(`ALTER TABLE Users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';`),
+		Down:    Exec(`ALTER TABLE Users DROP COLUMN role;`),
+	},
+	{
+		Version: 7,
+		Name:    "add_posts_listing_index",
+		Up: Exec(
+			`DROP INDEX idx_posts_created;`,
+			`CREATE INDEX idx_posts_created ON posts(created, id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_posts_created;`,
+			`CREATE INDEX idx_posts_created ON posts(created);`,
+		),
+	},
+	{
+		Version: 8,
+		Name:    "add_search_index",
+		Up: Exec(
+			`CREATE VIRTUAL TABLE posts_fts USING fts5(title, content, content='posts', content_rowid='id');`,
+			`CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+				INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+			END;`,
+			`CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+				INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+			END;`,
+			`CREATE TRIGGER posts_fts_update AFTER UPDATE OF title, content ON posts BEGIN
+				INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+				INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+			END;`,
+			`INSERT INTO posts_fts(posts_fts) VALUES ('rebuild');`,
+			`CREATE VIRTUAL TABLE comments_fts USING fts5(CContent, content='comments', content_rowid='Id');`,
+			`CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments BEGIN
+				INSERT INTO comments_fts(rowid, CContent) VALUES (new.Id, new.CContent);
+			END;`,
+			`CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments BEGIN
+				INSERT INTO comments_fts(comments_fts, rowid, CContent) VALUES ('delete', old.Id, old.CContent);
+			END;`,
+			`CREATE TRIGGER comments_fts_update AFTER UPDATE OF CContent ON comments BEGIN
+				INSERT INTO comments_fts(comments_fts, rowid, CContent) VALUES ('delete', old.Id, old.CContent);
+				INSERT INTO comments_fts(rowid, CContent) VALUES (new.Id, new.CContent);
+			END;`,
+			`INSERT INTO comments_fts(comments_fts) VALUES ('rebuild');`,
+		),
+		Down: Exec(
+			`DROP TRIGGER comments_fts_update;`,
+			`DROP TRIGGER comments_fts_delete;`,
+			`DROP TRIGGER comments_fts_insert;`,
+			`DROP TABLE comments_fts;`,
+			`DROP TRIGGER posts_fts_update;`,
+			`DROP TRIGGER posts_fts_delete;`,
+			`DROP TRIGGER posts_fts_insert;`,
+			`DROP TABLE posts_fts;`,
+		),
+	},
+	{
+		Version: 9,
+		Name:    "convert_comment_breaks",
+		Up:      Exec(`UPDATE comments SET CContent = REPLACE(CContent, '<br>', char(10)) WHERE CContent LIKE '%<br>%';`),
+		Down:    Exec(`UPDATE comments SET CContent = REPLACE(CContent, char(10), '<br>') WHERE CContent LIKE '%' || char(10) || '%';`),
+	},
+	{
+		Version: 10,
+		Name:    "create_attachments",
+		Up: Exec(
+			`CREATE TABLE attachments (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				content_type TEXT NOT NULL,
+				size INTEGER NOT NULL,
+				file_key TEXT NOT NULL UNIQUE,
+				thumb_key TEXT NOT NULL DEFAULT '',
+				created DATETIME NOT NULL
+			);`,
+			`CREATE INDEX idx_attachments_post ON attachments(post_id, id);`,
+		),
+		Down: Exec(`DROP TABLE attachments;`),
+	},
+	{
+		// Duplicate rows left by racing toggles are collapsed into the most
+		// recent one before the indexes make them impossible.
+		Version: 11,
+		Name:    "add_unique_reactions",
+		Up: Exec(
+			`DELETE FROM post_reactions WHERE rowid NOT IN (
+				SELECT MAX(rowid) FROM post_reactions GROUP BY user_id, post_id
+			);`,
+			`DELETE FROM comment_reactions WHERE rowid NOT IN (
+				SELECT MAX(rowid) FROM comment_reactions GROUP BY user_id, comment_id
+			);`,
+			`DELETE FROM post_reactions WHERE COALESCE("like", 0) = 0 AND COALESCE(dislike, 0) = 0;`,
+			`DELETE FROM comment_reactions WHERE COALESCE("like", 0) = 0 AND COALESCE(dislike, 0) = 0;`,
+			`CREATE UNIQUE INDEX idx_post_reactions_user_post ON post_reactions(user_id, post_id);`,
+			`CREATE UNIQUE INDEX idx_comment_reactions_user_comment ON comment_reactions(user_id, comment_id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_comment_reactions_user_comment;`,
+			`DROP INDEX idx_post_reactions_user_post;`,
+		),
+	},
+	{
+		// Reactions become one row per user and target holding the kind of
+		// reaction. Rows without a like or a dislike, or pointing at rows
+		// that no longer exist, are dropped on the way.
+		Version: 12,
+		Name:    "add_reaction_kinds",
+		Up: Exec(
+			`CREATE TABLE post_reactions_new (
+				user_id INTEGER NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+				post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				kind TEXT NOT NULL,
+				created DATETIME NOT NULL,
+				PRIMARY KEY (user_id, post_id)
+			);`,
+			`INSERT INTO post_reactions_new (user_id, post_id, kind, created)
+				SELECT user_id, post_id, CASE WHEN "like" = 1 THEN 'like' ELSE 'dislike' END, CURRENT_TIMESTAMP
+				FROM post_reactions
+				WHERE ("like" = 1 OR dislike = 1)
+					AND user_id IN (SELECT id FROM Users) AND post_id IN (SELECT id FROM posts);`,
+			`DROP TABLE post_reactions;`,
+			`ALTER TABLE post_reactions_new RENAME TO post_reactions;`,
+			`CREATE INDEX idx_post_reactions_post ON post_reactions(post_id, kind);`,
+			`CREATE TABLE comment_reactions_new (
+				user_id INTEGER NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+				comment_id INTEGER NOT NULL REFERENCES comments(Id) ON DELETE CASCADE,
+				kind TEXT NOT NULL,
+				created DATETIME NOT NULL,
+				PRIMARY KEY (user_id, comment_id)
+			);`,
+			`INSERT INTO comment_reactions_new (user_id, comment_id, kind, created)
+				SELECT user_id, comment_id, CASE WHEN "like" = 1 THEN 'like' ELSE 'dislike' END, CURRENT_TIMESTAMP
+				FROM comment_reactions
+				WHERE ("like" = 1 OR dislike = 1)
+					AND user_id IN (SELECT id FROM Users) AND comment_id IN (SELECT Id FROM comments);`,
+			`DROP TABLE comment_reactions;`,
+			`ALTER TABLE comment_reactions_new RENAME TO comment_reactions;`,
+			`CREATE INDEX idx_comment_reactions_comment ON comment_reactions(comment_id, kind);`,
+		),
+		// Only likes and dislikes survive going back.
+		Down: Exec(
+			`CREATE TABLE post_reactions_old (
+				user_id INTEGER,
+				post_id INTEGER,
+				"like" INTEGER,
+				dislike INTEGER
+			);`,
+			`INSERT INTO post_reactions_old (user_id, post_id, "like", dislike)
+				SELECT user_id, post_id, CASE WHEN kind = 'like' THEN 1 ELSE 0 END, CASE WHEN kind = 'dislike' THEN 1 ELSE 0 END
+				FROM post_reactions WHERE kind IN ('like', 'dislike');`,
+			`DROP TABLE post_reactions;`,
+			`ALTER TABLE post_reactions_old RENAME TO post_reactions;`,
+			`CREATE UNIQUE INDEX idx_post_reactions_user_post ON post_reactions(user_id, post_id);`,
+			`CREATE TABLE comment_reactions_old (
+				user_id INTEGER,
+				comment_id INTEGER,
+				"like" INTEGER,
+				dislike INTEGER
+			);`,
+			`INSERT INTO comment_reactions_old (user_id, comment_id, "like", dislike)
+				SELECT user_id, comment_id, CASE WHEN kind = 'like' THEN 1 ELSE 0 END, CASE WHEN kind = 'dislike' THEN 1 ELSE 0 END
+				FROM comment_reactions WHERE kind IN ('like', 'dislike');`,
+			`DROP TABLE comment_reactions;`,
+			`ALTER TABLE comment_reactions_old RENAME TO comment_reactions;`,
+			`CREATE UNIQUE INDEX idx_comment_reactions_user_comment ON comment_reactions(user_id, comment_id);`,
+		),
+	},
+	{
+		Version: 13,
+		Name:    "add_counters",
+		Up: Exec(
+			`ALTER TABLE posts ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE posts ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE posts ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE comments ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE comments ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;`,
+			`UPDATE posts SET
+				like_count = (SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = posts.id AND r.kind = 'like'),
+				dislike_count = (SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = posts.id AND r.kind = 'dislike'),
+				comment_count = (SELECT COUNT(*) FROM comments c WHERE c.PostID = posts.id AND c.deleted_at IS NULL);`,
+			`UPDATE comments SET
+				like_count = (SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = comments.Id AND r.kind = 'like'),
+				dislike_count = (SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = comments.Id AND r.kind = 'dislike');`,
+			`CREATE INDEX idx_posts_net_likes ON posts ((like_count - dislike_count), created, id);`,
+			`CREATE INDEX idx_posts_comment_count ON posts (comment_count, created, id);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_posts_comment_count;`,
+			`DROP INDEX idx_posts_net_likes;`,
+			`ALTER TABLE comments DROP COLUMN dislike_count;`,
+			`ALTER TABLE comments DROP COLUMN like_count;`,
+			`ALTER TABLE posts DROP COLUMN comment_count;`,
+			`ALTER TABLE posts DROP COLUMN dislike_count;`,
+			`ALTER TABLE posts DROP COLUMN like_count;`,
+		),
+	},
+	{
+		Version: 14,
+		Name:    "hash_session_tokens",
+		Up: steps(
+			Exec(
+				`ALTER TABLE Sessions RENAME COLUMN token TO token_hash;`,
+				`ALTER TABLE Sessions ADD COLUMN remember INTEGER NOT NULL DEFAULT 0;`,
+			),
+			hashSessionTokens,
+		),
+		// The tokens cannot be recovered from their hashes, so rolling back
+		// signs everyone out.
+		Down: Exec(
+			`DELETE FROM Sessions;`,
+			`ALTER TABLE Sessions DROP COLUMN remember;`,
+			`ALTER TABLE Sessions RENAME COLUMN token_hash TO token;`,
+		),
+	},
+	{
+		Version: 15,
+		Name:    "add_session_details",
+		Up: Exec(
+			`ALTER TABLE Sessions ADD COLUMN created DATETIME;`,
+			`ALTER TABLE Sessions ADD COLUMN last_seen DATETIME;`,
+			`ALTER TABLE Sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE Sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';`,
+			`CREATE INDEX idx_sessions_user ON Sessions(user_id, last_seen);`,
+		),
+		Down: Exec(
+			`DROP INDEX idx_sessions_user;`,
+			`ALTER TABLE Sessions DROP COLUMN user_agent;`,
+			`ALTER TABLE Sessions DROP COLUMN ip;`,
+			`ALTER TABLE Sessions DROP COLUMN last_seen;`,
+			`ALTER TABLE Sessions DROP COLUMN created;`,
+		),
+	},
+	{
+		// Rows written with datetime('now') or CURRENT_TIMESTAMP hold
+		// "YYYY-MM-DD HH:MM:SS", while the driver writes times in the
+		// layout "2006-01-02 15:04:05.999999999-07:00": fractional seconds
+		// without trailing zeros, if any, and the offset, "+00:00" for the
+		// UTC times the models store. The same instant thus compares as
+		// different strings, which broke the "created = ?" test of cursor
+		// pages. Give the old rows the offset as well; having no fraction,
+		// they then read exactly as the driver would write them.
+		Version: 16,
+		Name:    "normalize_timestamps",
+		Up: Exec(
+			`UPDATE posts SET created = strftime('%Y-%m-%d %H:%M:%S', created) || '+00:00' WHERE length(created) = 19;`,
+			`UPDATE Users SET created = strftime('%Y-%m-%d %H:%M:%S', created) || '+00:00' WHERE length(created) = 19;`,
+			`UPDATE post_reactions SET created = strftime('%Y-%m-%d %H:%M:%S', created) || '+00:00' WHERE length(created) = 19;`,
+			`UPDATE comment_reactions SET created = strftime('%Y-%m-%d %H:%M:%S', created) || '+00:00' WHERE length(created) = 19;`,
+		),
+		// Both forms read back as the same time.
+		Down: Exec(),
+	},
+	{
+		// For a while migration 8 was recorded as applied without creating
+		// the search index when SQLite lacked FTS5. Create the index, with
+		// the statements of migration 8, for the databases migrated then.
+		Version: 17,
+		Name:    "create_missing_search_index",
+		Up: unlessTable("posts_fts", Exec(
+			`CREATE VIRTUAL TABLE posts_fts USING fts5(title, content, content='posts', content_rowid='id');`,
+			`CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+				INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+			END;`,
+			`CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+				INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+			END;`,
+			`CREATE TRIGGER posts_fts_update AFTER UPDATE OF title, content ON posts BEGIN
+				INSERT INTO posts_fts(posts_fts, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+				INSERT INTO posts_fts(rowid, title, content) VALUES (new.id, new.title, new.content);
+			END;`,
+			`INSERT INTO posts_fts(posts_fts) VALUES ('rebuild');`,
+			`CREATE VIRTUAL TABLE comments_fts USING fts5(CContent, content='comments', content_rowid='Id');`,
+			`CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments BEGIN
+				INSERT INTO comments_fts(rowid, CContent) VALUES (new.Id, new.CContent);
+			END;`,
+			`CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments BEGIN
+				INSERT INTO comments_fts(comments_fts, rowid, CContent) VALUES ('delete', old.Id, old.CContent);
+			END;`,
+			`CREATE TRIGGER comments_fts_update AFTER UPDATE OF CContent ON comments BEGIN
+				INSERT INTO comments_fts(comments_fts, rowid, CContent) VALUES ('delete', old.Id, old.CContent);
+				INSERT INTO comments_fts(rowid, CContent) VALUES (new.Id, new.CContent);
+			END;`,
+			`INSERT INTO comments_fts(comments_fts) VALUES ('rebuild');`,
+		)),
+		// The index belongs to migration 8, whose Down removes it.
+		Down: Exec(),
+	},
+}
+
+// needsFTS5 lists the migrations that cannot run on SQLite built without
+// FTS5. Such a build leaves them pending, and search falls back to LIKE,
+// until a build with FTS5 migrates the database. They only touch the search
+// index, so running them after later migrations is fine.
+var needsFTS5 = map[int]bool{8: true, 17: true}
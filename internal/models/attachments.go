@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"dyelesho/forum/internal/dbs"
+)
+
+// Attachment is a file uploaded with a post. The file itself lives in a
+// storage.Store under Key; ThumbKey is empty unless a thumbnail was made.
+type Attachment struct {
+	ID          int
+	PostID      int
+	Name        string
+	ContentType string
+	Size        int64
+	Key         string
+	ThumbKey    string
+	Created     time.Time
+}
+
+// IsImage reports whether the attachment can be shown inline.
+func (a *Attachment) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+type AttachmentModel struct {
+	DB *dbs.DB
+}
+
+func (m *AttachmentModel) Insert(a Attachment) (int, error) {
+	stmt := `INSERT INTO attachments (post_id, name, content_type, size, file_key, thumb_key, created)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	var id int
+	err := m.DB.QueryRow(stmt, a.PostID, a.Name, a.ContentType, a.Size, a.Key, a.ThumbKey, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (m *AttachmentModel) Get(id int) (*Attachment, error) {
+	stmt := `SELECT id, post_id, name, content_type, size, file_key, thumb_key, created
+		FROM attachments WHERE id = ?`
+	a := &Attachment{}
+	err := m.DB.QueryRow(stmt, id).Scan(&a.ID, &a.PostID, &a.Name, &a.ContentType, &a.Size, &a.Key, &a.ThumbKey, &a.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// ForPost returns the attachments of a post in upload order.
+func (m *AttachmentModel) ForPost(postID int) ([]Attachment, error) {
+	stmt := `SELECT id, post_id, name, content_type, size, file_key, thumb_key, created
+		FROM attachments WHERE post_id = ? ORDER BY id`
+	rows, err := m.DB.Query(stmt, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err = rows.Scan(&a.ID, &a.PostID, &a.Name, &a.ContentType, &a.Size, &a.Key, &a.ThumbKey, &a.Created); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// Keys returns every storage key still referenced by an attachment,
+// thumbnails included. Stored files missing from it are orphans.
+func (m *AttachmentModel) Keys() (map[string]bool, error) {
+	rows, err := m.DB.Query(`SELECT file_key, thumb_key FROM attachments`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{}
+	for rows.Next() {
+		var key, thumb string
+		if err = rows.Scan(&key, &thumb); err != nil {
+			return nil, err
+		}
+		keys[key] = true
+		if thumb != "" {
+			keys[thumb] = true
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
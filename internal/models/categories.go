@@ -0,0 +1,84 @@
+package models
+
+import (
+	"dyelesho/forum/internal/dbs"
+)
+
+type Category struct {
+	ID    int
+	Name  string
+	Posts int
+}
+
+type CategoryModel struct {
+	DB *dbs.DB
+}
+
+// All returns every category ordered by name, each with the number of posts
+// filed under it.
+func (m *CategoryModel) All() ([]Category, error) {
+	stmt := `SELECT c.id, c.name, COUNT(pc.post_id) FROM categories c
+		LEFT JOIN post_categories pc ON pc.category_id = c.id
+		GROUP BY c.id, c.name ORDER BY c.name`
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var c Category
+		if err = rows.Scan(&c.ID, &c.Name, &c.Posts); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Insert adds a category. Names are unique regardless of case.
+func (m *CategoryModel) Insert(name string) (int, error) {
+	var count int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM categories WHERE LOWER(name) = LOWER(?)`, name).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, ErrDuplicateEntry
+	}
+
+	var id int
+	err = m.DB.QueryRow(`INSERT INTO categories (name) VALUES (?) RETURNING id`, name).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Delete removes a category. Posts filed under it keep their other
+// categories.
+func (m *CategoryModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`DELETE FROM post_categories WHERE category_id = ?`, id); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM categories WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNoRecord
+	}
+	return tx.Commit()
+}
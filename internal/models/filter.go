@@ -0,0 +1,252 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"dyelesho/forum/internal/dbs"
+)
+
+// PostSort orders a post listing.
+type PostSort string
+
+const (
+	SortNew      PostSort = "new"      // newest first
+	SortHot      PostSort = "hot"      // net reactions weighed down by age
+	SortTop      PostSort = "top"      // most net reactions
+	SortComments PostSort = "comments" // most comments
+)
+
+// Ranked reports whether the listing is ordered by a score rather than by
+// date. Ranked listings are paged by position, see Cursor.
+func (s PostSort) Ranked() bool {
+	return s == SortHot || s == SortTop || s == SortComments
+}
+
+// Period limits a listing to recently created posts.
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodWeek  Period = "week"
+	PeriodMonth Period = "month"
+	PeriodAll   Period = "all"
+)
+
+// Since returns the earliest creation time within the period counted back
+// from now, or the zero time for PeriodAll.
+func (p Period) Since(now time.Time) time.Time {
+	switch p {
+	case PeriodDay:
+		return now.AddDate(0, 0, -1)
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7)
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0)
+	}
+	return time.Time{}
+}
+
+// PostFilter selects posts for the home page. Every set field narrows the
+// result further.
+type PostFilter struct {
+	// Categories lists category names. A post matches when it is filed under
+	// any of them, or under all of them when MatchAll is set.
+	Categories []string
+	MatchAll   bool
+	// Author keeps only posts written by this user name.
+	Author string
+	// LikedBy keeps only posts liked by this user ID.
+	LikedBy int
+	// Period keeps only posts created within it.
+	Period Period
+	// Sort orders the posts, SortNew when empty.
+	Sort PostSort
+}
+
+// Normalized drops empty or repeated categories and fills in the default
+// sort and period.
+func (f PostFilter) Normalized() PostFilter {
+	seen := map[string]bool{}
+	categories := []string{}
+	for _, name := range f.Categories {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			categories = append(categories, name)
+		}
+	}
+	f.Categories = categories
+	if f.Sort == "" {
+		f.Sort = SortNew
+	}
+	if f.Period == "" {
+		f.Period = PeriodAll
+	}
+	return f
+}
+
+// conditions builds the WHERE conditions for f over posts aliased as p.
+func (f PostFilter) conditions(now time.Time) ([]string, []any) {
+	var conds []string
+	var args []any
+
+	if since := f.Period.Since(now); !since.IsZero() {
+		conds = append(conds, `p.created >= ?`)
+		args = append(args, since)
+	}
+
+	if f.Author != "" {
+		conds = append(conds, `p.user_name = ?`)
+		args = append(args, f.Author)
+	}
+	if f.LikedBy > 0 {
+		conds = append(conds, `EXISTS (SELECT 1 FROM post_reactions pr
+			WHERE pr.post_id = p.id AND pr.user_id = ? AND pr.kind = ?)`)
+		args = append(args, f.LikedBy, ReactionLike)
+	}
+	if len(f.Categories) > 0 {
+		in := `SELECT COUNT(*) FROM post_categories pc
+			INNER JOIN categories c ON c.id = pc.category_id
+			WHERE pc.post_id = p.id AND c.name IN (` + placeholders(len(f.Categories)) + `)`
+		if f.MatchAll {
+			conds = append(conds, `(`+in+`) = ?`)
+		} else {
+			conds = append(conds, `(`+in+`) > 0`)
+		}
+		for _, name := range f.Categories {
+			args = append(args, name)
+		}
+		if f.MatchAll {
+			args = append(args, len(f.Categories))
+		}
+	}
+
+	return conds, args
+}
+
+func where(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// Filter returns one page of the posts matching f in the order asked for by
+// f.Sort.
+func (m *Model) Filter(f PostFilter, p Pagination) (*PostPage, error) {
+	f = f.Normalized()
+	now := time.Now().UTC()
+	conds, args := f.conditions(now)
+
+	var total int
+	stmt := `SELECT COUNT(*) FROM posts p` + where(conds)
+	if err := m.DB.QueryRow(stmt, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	if f.Sort.Ranked() {
+		return m.ranked(f.Sort, conds, args, now, p, total)
+	}
+
+	// Paging backwards walks the listing in reverse and flips the rows
+	// afterwards. One extra row tells whether the listing goes on.
+	order := ` ORDER BY p.created DESC, p.id DESC`
+	switch {
+	case p.Before != nil:
+		conds = append(conds, `(p.created > ? OR (p.created = ? AND p.id > ?))`)
+		args = append(args, p.Before.Created, p.Before.Created, p.Before.ID)
+		order = ` ORDER BY p.created ASC, p.id ASC`
+	case p.After != nil:
+		conds = append(conds, `(p.created < ? OR (p.created = ? AND p.id < ?))`)
+		args = append(args, p.After.Created, p.After.Created, p.After.ID)
+	}
+	stmt = listQuery +
+		where(conds) + order + ` LIMIT ?`
+	args = append(args, p.Size()+1)
+
+	posts, err := m.queryPosts(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	if p.Before != nil {
+		reversePosts(posts)
+	}
+
+	page := NewPostPage(posts, p, total)
+	if err = m.attachCategories(page.Posts...); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// listQuery selects what listings show of the posts, aliased as p.
+const listQuery = `SELECT p.id, p.title, p.content, p.created, p.user_name,
+	p.like_count, p.dislike_count, p.comment_count FROM posts p`
+
+// netReactions matches the expression of the idx_posts_net_likes index.
+const netReactions = `(p.like_count - p.dislike_count)`
+
+// ranked returns one page of the posts matching conds, highest score first.
+// Top and most discussed are read off indexes on the post counters.
+func (m *Model) ranked(sort PostSort, conds []string, args []any, now time.Time, p Pagination, total int) (*PostPage, error) {
+	var score string
+	switch sort {
+	case SortTop:
+		score = netReactions
+	case SortComments:
+		score = `p.comment_count`
+	default:
+		// Hot divides the net reactions by the squared age in hours. The
+		// two extra hours keep a new post from shooting to the top on its
+		// first like.
+		age := `((julianday(?) - julianday(p.created)) * 24 + 2)`
+		if m.DB.Dialect == dbs.Postgres {
+			age = `(EXTRACT(EPOCH FROM (CAST(? AS TIMESTAMPTZ) - p.created)) / 3600 + 2)`
+		}
+		score = netReactions + ` / (` + age + ` * ` + age + `)`
+		args = append(args, now, now)
+	}
+
+	offset, limit := p.Window()
+	stmt := listQuery +
+		where(conds) + ` ORDER BY ` + score + ` DESC, p.created DESC, p.id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	posts, err := m.queryPosts(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := NewRankedPage(posts, offset, total)
+	if err = m.attachCategories(page.Posts...); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// queryPosts runs a query that starts with listQuery.
+func (m *Model) queryPosts(stmt string, args ...any) ([]*Post, error) {
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+	for rows.Next() {
+		post := &Post{}
+		err = rows.Scan(&post.ID, &post.Title, &post.Content, &post.Created, &post.UserName,
+			&post.Likes, &post.Dislikes, &post.CommentCount)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func reversePosts(posts []*Post) {
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Rows created with datetime('now') before migration 16 must page like the
+// ones the driver writes, which carry fractional seconds and a "+00:00"
+// offset, also when both kinds share a second.
+func TestFilterPagesLegacyTimestamps(t *testing.T) {
+	db := openTestDB(t)
+	migrateTestDB(t, db, 15)
+	fractional := time.Date(2024, 1, 2, 10, 0, 0, 250_000_000, time.UTC)
+	for i, created := range []any{
+		"2024-01-01 10:00:00",
+		"2024-01-02 10:00:00",
+		"2024-01-02 10:00:00",
+		fractional,
+		fractional,
+		fractional,
+		"2024-01-03 10:00:00",
+	} {
+		_, err := db.Exec(`INSERT INTO posts (title, content, created, user_name) VALUES (?, ?, ?, ?)`,
+			fmt.Sprint("Post ", i+1), "Content", created, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored string
+	if err := db.QueryRow(`SELECT CAST(created AS TEXT) FROM posts WHERE id = 4`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored != "2024-01-02 10:00:00.25+00:00" {
+		t.Fatalf("the driver wrote %q", stored)
+	}
+	migrateTestDB(t, db, 0)
+
+	posts := &Model{DB: db}
+	if _, err := posts.Insert("Post 8", "Content", nil, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	want := []int{8, 7, 6, 5, 4, 3, 2, 1}
+
+	var got []int
+	p := Pagination{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("paging forwards does not end, got %v", got)
+		}
+		page, err := posts.Filter(PostFilter{}, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, post := range page.Posts {
+			got = append(got, post.ID)
+		}
+		if page.Next == nil {
+			break
+		}
+		p = Pagination{After: page.Next, Limit: 2}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("paging forwards got %v, want %v", got, want)
+	}
+
+	got = nil
+	p = Pagination{Before: &Cursor{Created: mustPostCreated(t, posts, 1), ID: 1}, Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("paging backwards does not end, got %v", got)
+		}
+		page, err := posts.Filter(PostFilter{}, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := len(page.Posts) - 1; i >= 0; i-- {
+			got = append(got, page.Posts[i].ID)
+		}
+		if page.Prev == nil {
+			break
+		}
+		p = Pagination{Before: page.Prev, Limit: 2}
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]int{2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("paging backwards got %v, want [2 3 4 5 6 7 8]", got)
+	}
+}
+
+func mustPostCreated(t *testing.T, posts *Model, id int) time.Time {
+	t.Helper()
+	post, err := posts.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post.Created
+}
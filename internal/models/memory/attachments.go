@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"sort"
+
+	"dyelesho/forum/internal/models"
+)
+
+type AttachmentModel struct {
+	DB *DB
+}
+
+func (m *AttachmentModel) Insert(a models.Attachment) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	if _, ok := m.DB.posts[a.PostID]; !ok {
+		return 0, models.ErrNoRecord
+	}
+	m.DB.lastAttachmentID++
+	a.ID = m.DB.lastAttachmentID
+	a.Created = now()
+	m.DB.attachments[a.ID] = &a
+	return a.ID, nil
+}
+
+func (m *AttachmentModel) Get(id int) (*models.Attachment, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	a, ok := m.DB.attachments[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	attachment := *a
+	return &attachment, nil
+}
+
+func (m *AttachmentModel) ForPost(postID int) ([]models.Attachment, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	attachments := []models.Attachment{}
+	for _, a := range m.DB.attachments {
+		if a.PostID == postID {
+			attachments = append(attachments, *a)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+func (m *AttachmentModel) Keys() (map[string]bool, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	keys := map[string]bool{}
+	for _, a := range m.DB.attachments {
+		keys[a.Key] = true
+		if a.ThumbKey != "" {
+			keys[a.ThumbKey] = true
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+
+	"dyelesho/forum/internal/models"
+)
+
+type CategoryModel struct {
+	DB *DB
+}
+
+func (m *CategoryModel) All() ([]models.Category, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	categories := []models.Category{}
+	for id, name := range m.DB.categories {
+		c := models.Category{ID: id, Name: name}
+		for _, ids := range m.DB.postCategories {
+			for _, categoryID := range ids {
+				if categoryID == id {
+					c.Posts++
+				}
+			}
+		}
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+func (m *CategoryModel) Insert(name string) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, existing := range m.DB.categories {
+		if strings.EqualFold(existing, name) {
+			return 0, models.ErrDuplicateEntry
+		}
+	}
+	m.DB.lastCategoryID++
+	m.DB.categories[m.DB.lastCategoryID] = name
+	return m.DB.lastCategoryID, nil
+}
+
+func (m *CategoryModel) Delete(id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	if _, ok := m.DB.categories[id]; !ok {
+		return models.ErrNoRecord
+	}
+	delete(m.DB.categories, id)
+	for postID, ids := range m.DB.postCategories {
+		kept := ids[:0]
+		for _, categoryID := range ids {
+			if categoryID != id {
+				kept = append(kept, categoryID)
+			}
+		}
+		m.DB.postCategories[postID] = kept
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Package memory provides in-memory implementations of the stores in
+// models. They keep everything in process memory and are meant for handler
+// tests and throwaway demo instances.
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"dyelesho/forum/internal/models"
+)
+
+type reactionKey struct {
+	userID   int
+	targetID int
+}
+
+type reaction struct {
+	kind    string
+	created time.Time
+}
+
+// DB holds the data shared by every store created from it.
+type DB struct {
+	mu sync.RWMutex
+
+	posts          map[int]*models.Post
+	revisions      map[int][]models.PostRevision
+	categories     map[int]string
+	postCategories map[int][]int
+	attachments    map[int]*models.Attachment
+	comments       map[int]*models.Comment
+	users          map[int]*models.User
+	sessions       map[string]*models.Session // by token hash
+
+	postReactions    map[reactionKey]reaction
+	commentReactions map[reactionKey]reaction
+
+	lastPostID       int
+	lastRevisionID   int
+	lastCategoryID   int
+	lastAttachmentID int
+	lastCommentID    int
+	lastUserID       int
+	lastSessionID    int
+}
+
+// defaultCategories matches the categories seeded by the SQL migrations.
+var defaultCategories = []string{"Technology", "Travel", "Health", "Entertainment"}
+
+func New() *DB {
+	db := &DB{
+		posts:            map[int]*models.Post{},
+		revisions:        map[int][]models.PostRevision{},
+		categories:       map[int]string{},
+		postCategories:   map[int][]int{},
+		attachments:      map[int]*models.Attachment{},
+		comments:         map[int]*models.Comment{},
+		users:            map[int]*models.User{},
+		sessions:         map[string]*models.Session{},
+		postReactions:    map[reactionKey]reaction{},
+		commentReactions: map[reactionKey]reaction{},
+	}
+	for _, name := range defaultCategories {
+		db.lastCategoryID++
+		db.categories[db.lastCategoryID] = name
+	}
+	return db
+}
+
+// NewStores returns a full set of stores backed by a fresh, empty DB.
+func NewStores() models.Stores {
+	db := New()
+	posts := &Model{DB: db}
+	return models.Stores{
+		Posts:       posts,
+		Categories:  &CategoryModel{DB: db},
+		Search:      &SearchModel{DB: db},
+		Attachments: &AttachmentModel{DB: db},
+		Comments:    posts,
+		Users:       &UserModel{DB: db},
+		Sessions:    &SessionModel{DB: db},
+		Reactions:   &ReactionModel{DB: db},
+	}
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// commentCount counts the comments of a post that were not deleted. It must
+// be called with a lock held.
+func (db *DB) commentCount(postID int) int {
+	n := 0
+	for _, c := range db.comments {
+		if c.PostID == postID && !c.Deleted {
+			n++
+		}
+	}
+	return n
+}
+
+// categoryNames returns the sorted category names of a post. It must be
+// called with a lock held.
+func (db *DB) categoryNames(postID int) []string {
+	var names []string
+	for _, id := range db.postCategories[postID] {
+		if name, ok := db.categories[id]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,378 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+
+	"dyelesho/forum/internal/models"
+)
+
+type Model struct {
+	DB *DB
+}
+
+func (m *Model) Insert(title string, content string, categoryIDs []int, userName string) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	m.DB.lastPostID++
+	m.DB.posts[m.DB.lastPostID] = &models.Post{
+		ID:       m.DB.lastPostID,
+		Title:    title,
+		Content:  content,
+		Created:  now(),
+		UserName: userName,
+	}
+	m.DB.postCategories[m.DB.lastPostID] = append([]int(nil), categoryIDs...)
+	return m.DB.lastPostID, nil
+}
+
+func (m *Model) Get(id int) (*models.Post, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	p, ok := m.DB.posts[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	post := *p
+	post.Categories = m.DB.categoryNames(id)
+	counts := countKinds(m.DB.postReactions, id)
+	post.Likes = counts[models.ReactionLike]
+	post.Dislikes = counts[models.ReactionDislike]
+	post.CommentCount = m.DB.commentCount(id)
+	return &post, nil
+}
+
+func (m *Model) Update(id int, title string, content string, categoryIDs []int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	p, ok := m.DB.posts[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+	m.DB.lastRevisionID++
+	edited := now()
+	m.DB.revisions[id] = append(m.DB.revisions[id], models.PostRevision{
+		ID:       m.DB.lastRevisionID,
+		PostID:   id,
+		Title:    p.Title,
+		Content:  p.Content,
+		Category: strings.Join(m.DB.categoryNames(id), " "),
+		Edited:   edited,
+	})
+	p.Title = title
+	p.Content = content
+	p.Updated = edited
+	m.DB.postCategories[id] = append([]int(nil), categoryIDs...)
+	return nil
+}
+
+func (m *Model) Delete(id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	if _, ok := m.DB.posts[id]; !ok {
+		return models.ErrNoRecord
+	}
+	for commentID, c := range m.DB.comments {
+		if c.PostID != id {
+			continue
+		}
+		for key := range m.DB.commentReactions {
+			if key.targetID == commentID {
+				delete(m.DB.commentReactions, key)
+			}
+		}
+		delete(m.DB.comments, commentID)
+	}
+	for key := range m.DB.postReactions {
+		if key.targetID == id {
+			delete(m.DB.postReactions, key)
+		}
+	}
+	delete(m.DB.revisions, id)
+	delete(m.DB.postCategories, id)
+	for attachmentID, a := range m.DB.attachments {
+		if a.PostID == id {
+			delete(m.DB.attachments, attachmentID)
+		}
+	}
+	delete(m.DB.posts, id)
+	return nil
+}
+
+func (m *Model) GetRevisions(postID int) ([]models.PostRevision, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	revisions := make([]models.PostRevision, len(m.DB.revisions[postID]))
+	copy(revisions, m.DB.revisions[postID])
+	return revisions, nil
+}
+
+func (m *Model) Latest(p models.Pagination) (*models.PostPage, error) {
+	return m.Filter(models.PostFilter{}, p)
+}
+
+func (m *Model) ByCategory(category string, p models.Pagination) (*models.PostPage, error) {
+	return m.Filter(models.PostFilter{Categories: []string{category}}, p)
+}
+
+func (m *Model) GetPostsByUser(name string, p models.Pagination) (*models.PostPage, error) {
+	return m.Filter(models.PostFilter{Author: name}, p)
+}
+
+func (m *Model) GetPostsByUserReaction(userID int, p models.Pagination) (*models.PostPage, error) {
+	return m.Filter(models.PostFilter{LikedBy: userID}, p)
+}
+
+// list returns copies of the posts accepted by keep in listing order, newest
+// first.
+func (m *Model) list(keep func(p *models.Post) bool) []*models.Post {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	posts := []*models.Post{}
+	for _, p := range m.DB.posts {
+		if keep(p) {
+			post := *p
+			post.Categories = m.DB.categoryNames(p.ID)
+			counts := countKinds(m.DB.postReactions, p.ID)
+			post.Likes = counts[models.ReactionLike]
+			post.Dislikes = counts[models.ReactionDislike]
+			post.CommentCount = m.DB.commentCount(p.ID)
+			posts = append(posts, &post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return newer(posts[i], models.Cursor{Created: posts[j].Created, ID: posts[j].ID}) })
+	return posts
+}
+
+func (m *Model) GetComments(postID int, viewerID int) ([]models.Comment, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	return m.comments(postID, viewerID), nil
+}
+
+// comments must be called with the read lock held.
+func (m *Model) comments(postID int, viewerID int) []models.Comment {
+	comments := []models.Comment{}
+	for _, c := range m.DB.comments {
+		if c.PostID != postID {
+			continue
+		}
+		comment := *c
+		comment.Reactions = countKinds(m.DB.commentReactions, c.Id)
+		comment.Likes = comment.Reactions[models.ReactionLike]
+		comment.Dislikes = comment.Reactions[models.ReactionDislike]
+		comment.ViewerReaction = m.DB.commentReactions[reactionKey{userID: viewerID, targetID: c.Id}].kind
+		comments = append(comments, comment)
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].Id < comments[j].Id })
+	return comments
+}
+
+func (m *Model) PostComment(CommentInput models.Comment) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	m.DB.lastCommentID++
+	m.DB.comments[m.DB.lastCommentID] = &models.Comment{
+		Id:       m.DB.lastCommentID,
+		Author:   CommentInput.Author,
+		CContent: CommentInput.CContent,
+		PostID:   CommentInput.PostID,
+		ParentID: CommentInput.ParentID,
+	}
+	return nil
+}
+
+func (m *Model) GetCommentTree(postID int, maxDepth int, viewerID int) ([]*models.Comment, error) {
+	comments, err := m.GetComments(postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return models.BuildCommentTree(comments, maxDepth), nil
+}
+
+func (m *Model) GetComment(id int) (*models.Comment, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	c, ok := m.DB.comments[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	comment := *c
+	return &comment, nil
+}
+
+func (m *Model) UpdateComment(id int, content string) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	c, ok := m.DB.comments[id]
+	if !ok || c.Deleted {
+		return models.ErrNoRecord
+	}
+	c.CContent = content
+	c.Edited = now()
+	return nil
+}
+
+func (m *Model) DeleteComment(id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	c, ok := m.DB.comments[id]
+	if !ok || c.Deleted {
+		return models.ErrNoRecord
+	}
+	m.deleteCommentReactions(id)
+	if m.hasReplies(id) {
+		c.CContent = ""
+		c.Deleted = true
+		return nil
+	}
+
+	for c != nil {
+		delete(m.DB.comments, c.Id)
+		m.deleteCommentReactions(c.Id)
+
+		parent, ok := m.DB.comments[c.ParentID]
+		if !ok || !parent.Deleted || m.hasReplies(parent.Id) {
+			break
+		}
+		c = parent
+	}
+	return nil
+}
+
+// hasReplies and deleteCommentReactions must be called with the lock held.
+
+func (m *Model) hasReplies(id int) bool {
+	for _, c := range m.DB.comments {
+		if c.ParentID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Model) deleteCommentReactions(id int) {
+	for key := range m.DB.commentReactions {
+		if key.targetID == id {
+			delete(m.DB.commentReactions, key)
+		}
+	}
+}
+
+func (m *Model) Filter(f models.PostFilter, p models.Pagination) (*models.PostPage, error) {
+	f = f.Normalized()
+	since := f.Period.Since(now())
+
+	// keep runs inside list, with the read lock held.
+	posts := m.list(func(post *models.Post) bool {
+		if post.Created.Before(since) {
+			return false
+		}
+		if f.Author != "" && post.UserName != f.Author {
+			return false
+		}
+		if f.LikedBy > 0 && m.DB.postReactions[reactionKey{userID: f.LikedBy, targetID: post.ID}].kind != models.ReactionLike {
+			return false
+		}
+		if len(f.Categories) == 0 {
+			return true
+		}
+		names := m.DB.categoryNames(post.ID)
+		matched := 0
+		for _, want := range f.Categories {
+			for _, name := range names {
+				if name == want {
+					matched++
+					break
+				}
+			}
+		}
+		if f.MatchAll {
+			return matched == len(f.Categories)
+		}
+		return matched > 0
+	})
+
+	if f.Sort.Ranked() {
+		m.rank(posts, f.Sort)
+		offset, limit := p.Window()
+		if offset > len(posts) {
+			offset = len(posts)
+		}
+		end := offset + limit
+		if end > len(posts) {
+			end = len(posts)
+		}
+		return models.NewRankedPage(posts[offset:end], offset, len(posts)), nil
+	}
+
+	// Cut the same limit+1 window the SQL query would return.
+	size := p.Size()
+	start, end := 0, len(posts)
+	switch {
+	case p.Before != nil:
+		end = 0
+		for end < len(posts) && newer(posts[end], *p.Before) {
+			end++
+		}
+		if start = end - size - 1; start < 0 {
+			start = 0
+		}
+	case p.After != nil:
+		for start < len(posts) && !older(posts[start], *p.After) {
+			start++
+		}
+		fallthrough
+	default:
+		if end = start + size + 1; end > len(posts) {
+			end = len(posts)
+		}
+	}
+	return models.NewPostPage(posts[start:end], p, len(posts)), nil
+}
+
+// rank sorts posts, which must be newest first, by the score the SQL models
+// use for by.
+func (m *Model) rank(posts []*models.Post, by models.PostSort) {
+	scores := make(map[int]float64, len(posts))
+	for _, post := range posts {
+		switch by {
+		case models.SortComments:
+			scores[post.ID] = float64(post.CommentCount)
+		default:
+			net := float64(post.Likes - post.Dislikes)
+			if by == models.SortHot {
+				age := now().Sub(post.Created).Hours() + 2
+				net /= age * age
+			}
+			scores[post.ID] = net
+		}
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return scores[posts[i].ID] > scores[posts[j].ID] })
+}
+
+// RepairCounters has nothing to do: the counts are worked out on every read.
+func (m *Model) RepairCounters() (int, error) {
+	return 0, nil
+}
+
+// newer reports whether post comes before c in listing order.
+func newer(post *models.Post, c models.Cursor) bool {
+	return post.Created.After(c.Created) || post.Created.Equal(c.Created) && post.ID > c.ID
+}
+
+// older reports whether post comes after c in listing order.
+func older(post *models.Post, c models.Cursor) bool {
+	return post.Created.Before(c.Created) || post.Created.Equal(c.Created) && post.ID < c.ID
+}
@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"sort"
+
+	"dyelesho/forum/internal/models"
+)
+
+type ReactionModel struct {
+	DB *DB
+}
+
+func (r *ReactionModel) ReactToPost(userID, postID int, kind string) error {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	if _, ok := r.DB.posts[postID]; !ok {
+		return models.ErrNoRecord
+	}
+	toggle(r.DB.postReactions, reactionKey{userID, postID}, kind)
+	return nil
+}
+
+func (r *ReactionModel) ReactToComment(userID, commentID int, kind string) error {
+	r.DB.mu.Lock()
+	defer r.DB.mu.Unlock()
+
+	if _, ok := r.DB.comments[commentID]; !ok {
+		return models.ErrNoRecord
+	}
+	toggle(r.DB.commentReactions, reactionKey{userID, commentID}, kind)
+	return nil
+}
+
+// toggle removes the reaction if the user already gave the same one and
+// otherwise replaces whatever the user had before. It must be called with
+// the lock held.
+func toggle(reactions map[reactionKey]reaction, key reactionKey, kind string) {
+	if reactions[key].kind == kind {
+		delete(reactions, key)
+		return
+	}
+	reactions[key] = reaction{kind: kind, created: now()}
+}
+
+func (r *ReactionModel) PostReactions(userID, postID int) (*models.ReactionSummary, error) {
+	return r.summary(r.DB.postReactions, userID, postID), nil
+}
+
+func (r *ReactionModel) CommentReactions(userID, commentID int) (*models.ReactionSummary, error) {
+	return r.summary(r.DB.commentReactions, userID, commentID), nil
+}
+
+func (r *ReactionModel) summary(reactions map[reactionKey]reaction, userID, targetID int) *models.ReactionSummary {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	return &models.ReactionSummary{
+		Counts: countKinds(reactions, targetID),
+		Viewer: reactions[reactionKey{userID, targetID}].kind,
+	}
+}
+
+func (r *ReactionModel) PostReactors(postID int) ([]models.Reactor, error) {
+	return r.reactors(r.DB.postReactions, postID), nil
+}
+
+func (r *ReactionModel) CommentReactors(commentID int) ([]models.Reactor, error) {
+	return r.reactors(r.DB.commentReactions, commentID), nil
+}
+
+func (r *ReactionModel) reactors(reactions map[reactionKey]reaction, targetID int) []models.Reactor {
+	r.DB.mu.RLock()
+	defer r.DB.mu.RUnlock()
+
+	reactors := []models.Reactor{}
+	for key, re := range reactions {
+		if key.targetID != targetID {
+			continue
+		}
+		if u, ok := r.DB.users[key.userID]; ok {
+			reactors = append(reactors, models.Reactor{UserName: u.Name, Kind: re.kind, Created: re.created})
+		}
+	}
+	sort.Slice(reactors, func(i, j int) bool {
+		if !reactors[i].Created.Equal(reactors[j].Created) {
+			return reactors[i].Created.Before(reactors[j].Created)
+		}
+		return reactors[i].UserName < reactors[j].UserName
+	})
+	return reactors
+}
+
+// countKinds must be called with a lock held.
+func countKinds(reactions map[reactionKey]reaction, targetID int) map[string]int {
+	counts := map[string]int{}
+	for key, re := range reactions {
+		if key.targetID == targetID {
+			counts[re.kind]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"dyelesho/forum/internal/models"
+)
+
+type SearchModel struct {
+	DB *DB
+}
+
+// snippetRadius is how many bytes of context are kept around the first
+// match in a snippet.
+const snippetRadius = 60
+
+// Search matches case-insensitive substrings instead of words. Results are
+// ranked by how often the terms occur.
+func (m *SearchModel) Search(q models.SearchQuery) (*models.SearchPage, error) {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	page := &models.SearchPage{Page: q.Page, HasPrev: q.Page > 1, Results: []models.SearchResult{}}
+	terms := strings.Fields(strings.ToLower(q.Text))
+	if len(terms) == 0 {
+		return page, nil
+	}
+
+	m.DB.mu.RLock()
+	var results []models.SearchResult
+	keep := func(post *models.Post, author string) bool {
+		if q.Author != "" && author != q.Author {
+			return false
+		}
+		if q.Category != "" && !contains(m.DB.categoryNames(post.ID), q.Category) {
+			return false
+		}
+		if !q.From.IsZero() && post.Created.Before(q.From) {
+			return false
+		}
+		return q.To.IsZero() || post.Created.Before(q.To)
+	}
+	for _, p := range m.DB.posts {
+		hits := occurrences(p.Title+" "+p.Content, terms)
+		if hits == 0 || !keep(p, p.UserName) {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			PostID: p.ID, Title: p.Title, Author: p.UserName, Created: p.Created,
+			Snippet: snippet(p.Content, terms), Rank: -float64(hits),
+		})
+	}
+	for _, c := range m.DB.comments {
+		p, ok := m.DB.posts[c.PostID]
+		if !ok || c.Deleted {
+			continue
+		}
+		hits := occurrences(c.CContent, terms)
+		if hits == 0 || !keep(p, c.Author) {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			PostID: p.ID, CommentID: c.Id, Title: p.Title, Author: c.Author, Created: p.Created,
+			Snippet: snippet(c.CContent, terms), Rank: -float64(hits),
+		})
+	}
+	m.DB.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank < results[j].Rank
+		}
+		return results[i].Created.After(results[j].Created)
+	})
+
+	start := (q.Page - 1) * models.DefaultPageSize
+	if start > len(results) {
+		start = len(results)
+	}
+	end := start + models.DefaultPageSize
+	if end < len(results) {
+		page.HasNext = true
+	} else {
+		end = len(results)
+	}
+	page.Results = append(page.Results, results[start:end]...)
+	return page, nil
+}
+
+// occurrences counts the terms in text, or returns zero when any of them is
+// missing.
+func occurrences(text string, terms []string) int {
+	text = strings.ToLower(text)
+	total := 0
+	for _, term := range terms {
+		n := strings.Count(text, term)
+		if n == 0 {
+			return 0
+		}
+		total += n
+	}
+	return total
+}
+
+// snippet cuts the text around the first match and marks every term in it.
+func snippet(text string, terms []string) []models.SnippetPart {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// A few runes change length when lowered; show the lowered text
+		// rather than cut it at the wrong offsets.
+		text = lower
+	}
+	first := len(text)
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && i < first {
+			first = i
+		}
+	}
+
+	start, end := first-snippetRadius, first+snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	if end > len(text) {
+		end = len(text)
+	}
+	// Stay on rune boundaries.
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	var parts []models.SnippetPart
+	if start > 0 {
+		parts = append(parts, models.SnippetPart{Text: "…"})
+	}
+	window, lowerWindow := text[start:end], lower[start:end]
+	for window != "" {
+		at, length := len(window), 0
+		for _, term := range terms {
+			if i := strings.Index(lowerWindow, term); i >= 0 && (i < at || i == at && len(term) > length) {
+				at, length = i, len(term)
+			}
+		}
+		if at > 0 {
+			parts = append(parts, models.SnippetPart{Text: window[:at]})
+		}
+		if length == 0 {
+			break
+		}
+		parts = append(parts, models.SnippetPart{Text: window[at : at+length], Match: true})
+		window, lowerWindow = window[at+length:], lowerWindow[at+length:]
+	}
+	if end < len(text) {
+		parts = append(parts, models.SnippetPart{Text: "…"})
+	}
+	return parts
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
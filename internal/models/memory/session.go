@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"sort"
+
+	"dyelesho/forum/internal/models"
+)
+
+type SessionModel struct {
+	DB *DB
+}
+
+func (m *SessionModel) CreateSession(session *models.Session) error {
+	token, err := models.NewToken()
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	m.DB.lastSessionID++
+	session.ID = m.DB.lastSessionID
+	session.Token = token
+	session.Created = now()
+	session.LastSeen = session.Created
+	session.ExpirationDate = session.Created.Add(session.Lifetime())
+
+	stored := *session
+	stored.Token = ""
+	m.DB.sessions[models.HashToken(token)] = &stored
+	return nil
+}
+
+func (m *SessionModel) GetSessionFromToken(token string) (*models.Session, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	s, ok := m.DB.sessions[models.HashToken(token)]
+	if !ok || !s.ExpirationDate.After(now()) {
+		return nil, models.ErrNoRecord
+	}
+	session := *s
+	session.Token = token
+	return &session, nil
+}
+
+func (m *SessionModel) RenewSession(session *models.Session) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, s := range m.DB.sessions {
+		if s.ID == session.ID {
+			s.ExpirationDate = session.ExpirationDate.UTC()
+			s.LastSeen = session.LastSeen.UTC()
+			s.IP = session.IP
+			s.UserAgent = session.UserAgent
+		}
+	}
+	return nil
+}
+
+func (m *SessionModel) UserSessions(userID int) ([]models.Session, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, s := range m.DB.sessions {
+		if s.UserID == userID && s.ExpirationDate.After(now()) {
+			sessions = append(sessions, *s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastSeen.Equal(sessions[j].LastSeen) {
+			return sessions[i].LastSeen.After(sessions[j].LastSeen)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (m *SessionModel) DeleteSession(userID, id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for hash, s := range m.DB.sessions {
+		if s.UserID == userID && s.ID == id {
+			delete(m.DB.sessions, hash)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SessionModel) DeleteOtherSessions(userID, keepID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for hash, s := range m.DB.sessions {
+		if s.UserID == userID && s.ID != keepID {
+			delete(m.DB.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (m *SessionModel) DeleteSessionByUserId(userId int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for hash, s := range m.DB.sessions {
+		if s.UserID == userId {
+			delete(m.DB.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (m *SessionModel) DeleteExpiredSessions() (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	cutoff := now()
+	n := 0
+	for hash, s := range m.DB.sessions {
+		if s.ExpirationDate.Before(cutoff) {
+			delete(m.DB.sessions, hash)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"sort"
+
+	"dyelesho/forum/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserModel struct {
+	DB *DB
+}
+
+// Passwords are hashed with the minimum cost: the data never outlives the
+// process, and tests create many users.
+const passwordCost = bcrypt.MinCost
+
+func (m *UserModel) Insert(name, email, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, u := range m.DB.users {
+		if u.Email == email || u.Name == name {
+			return models.ErrDuplicateEntry
+		}
+	}
+
+	m.DB.lastUserID++
+	m.DB.users[m.DB.lastUserID] = &models.User{
+		ID:             m.DB.lastUserID,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        now(),
+		Role:           models.RoleUser,
+	}
+	return nil
+}
+
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	m.DB.mu.RLock()
+	u := m.byEmail(email)
+	m.DB.mu.RUnlock()
+
+	if u == nil {
+		return 0, models.ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(u.HashedPassword, []byte(password)); err != nil {
+		return 0, models.ErrInvalidCredentials
+	}
+	return u.ID, nil
+}
+
+func (m *UserModel) GetUserNameByEmail(email string) (string, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	u := m.byEmail(email)
+	if u == nil {
+		return "", models.ErrNoRecord
+	}
+	return u.Name, nil
+}
+
+func (m *UserModel) Get(id int) (*models.User, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	u, ok := m.DB.users[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	user := *u
+	return &user, nil
+}
+
+func (m *UserModel) All() ([]models.User, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	users := make([]models.User, 0, len(m.DB.users))
+	for _, u := range m.DB.users {
+		user := *u
+		user.HashedPassword = nil
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (m *UserModel) SetRole(email, role string) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	u := m.byEmail(email)
+	if u == nil {
+		return 0, models.ErrNoRecord
+	}
+	u.Role = role
+	return u.ID, nil
+}
+
+// byEmail must be called with a lock held.
+func (m *UserModel) byEmail(email string) *models.User {
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			return u
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPageSize is used when a Pagination does not set Limit.
+const DefaultPageSize = 10
+
+// MaxPageSize caps the Limit a caller may ask for.
+const MaxPageSize = 100
+
+var ErrInvalidCursor = errors.New("models: invalid cursor")
+
+// Cursor marks a post in the listing order, newest first by created and
+// then by id. Ranked listings, whose order shifts as people react and
+// comment, mark the position in the listing with Offset instead.
+type Cursor struct {
+	Created time.Time
+	ID      int
+	Offset  int
+}
+
+// Ranked reports whether c marks a position in a ranked listing.
+func (c Cursor) Ranked() bool {
+	return c.Offset > 0
+}
+
+// Encode returns an opaque, URL-safe form of the cursor.
+func (c Cursor) Encode() string {
+	raw := c.Created.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.ID)
+	if c.Ranked() {
+		raw = "#" + strconv.Itoa(c.Offset)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a string made by Cursor.Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if strings.HasPrefix(string(raw), "#") {
+		c := Cursor{}
+		if c.Offset, err = strconv.Atoi(string(raw[1:])); err != nil || c.Offset < 1 {
+			return Cursor{}, ErrInvalidCursor
+		}
+		return c, nil
+	}
+	created, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	c := Cursor{}
+	if c.Created, err = time.Parse(time.RFC3339Nano, created); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	c.Created = c.Created.UTC()
+	if c.ID, err = strconv.Atoi(id); err != nil || c.ID < 1 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func cursorOf(p *Post) *Cursor {
+	return &Cursor{Created: p.Created, ID: p.ID}
+}
+
+// Pagination asks for one page of a listing. With After set the page holds
+// the posts that follow that cursor, with Before set the ones that precede
+// it; with neither it is the first page.
+type Pagination struct {
+	After  *Cursor
+	Before *Cursor
+	Limit  int
+}
+
+// Size returns the page size asked for, within the allowed bounds.
+func (p Pagination) Size() int {
+	switch {
+	case p.Limit < 1:
+		return DefaultPageSize
+	case p.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return p.Limit
+}
+
+// Window returns the offset and the number of rows of the page p asks for
+// in a ranked listing.
+func (p Pagination) Window() (offset, limit int) {
+	limit = p.Size()
+	switch {
+	case p.After != nil:
+		offset = p.After.Offset
+	case p.Before != nil:
+		if offset = p.Before.Offset - limit; offset < 0 {
+			offset = 0
+		}
+		limit = p.Before.Offset - offset
+	}
+	return offset, limit
+}
+
+// PostPage is one page of a listing. Prev and Next are nil at either end.
+type PostPage struct {
+	Posts []*Post
+	Prev  *Cursor
+	Next  *Cursor
+	// Total counts every post in the listing, not just this page.
+	Total int
+}
+
+// NewPostPage trims the Size()+1 rows fetched for p into a page. Rows must
+// be in listing order, also when paging backwards, in which case the extra
+// row comes first.
+func NewPostPage(rows []*Post, p Pagination, total int) *PostPage {
+	limit := p.Size()
+	more := len(rows) > limit
+	if more {
+		if p.Before != nil {
+			rows = rows[len(rows)-limit:]
+		} else {
+			rows = rows[:limit]
+		}
+	}
+
+	page := &PostPage{Posts: rows, Total: total}
+	if len(rows) == 0 {
+		return page
+	}
+	first, last := cursorOf(rows[0]), cursorOf(rows[len(rows)-1])
+	if p.Before != nil {
+		page.Next = last
+		if more {
+			page.Prev = first
+		}
+	} else {
+		if p.After != nil {
+			page.Prev = first
+		}
+		if more {
+			page.Next = last
+		}
+	}
+	return page
+}
+
+// NewRankedPage wraps the rows of a ranked listing that start at offset into
+// a page. total is needed to tell whether there is a next page.
+func NewRankedPage(rows []*Post, offset int, total int) *PostPage {
+	page := &PostPage{Posts: rows, Total: total}
+	if offset > 0 {
+		page.Prev = &Cursor{Offset: offset}
+	}
+	if end := offset + len(rows); end < total {
+		page.Next = &Cursor{Offset: end}
+	}
+	return page
+}
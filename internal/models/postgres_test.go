@@ -0,0 +1,124 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestPostgresStores runs the SQL stores against a PostgreSQL server, which
+// catches queries that only SQLite accepts. Set FORUM_TEST_POSTGRES_DSN to
+// run it.
+func TestPostgresStores(t *testing.T) {
+	db := newPostgresTestDB(t)
+	stores := NewStores(db)
+
+	for _, name := range []string{"alice", "bob"} {
+		if err := stores.Users.Insert(name, name+"@example.com", "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aliceID, err := stores.Users.Authenticate("alice@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postID, err := stores.Posts.Insert("Hiking in the Alps", "Long walks", []int{1, 2}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stores.Posts.Update(postID, "Hiking in the Alps", "Long walks and cheap huts", []int{2}); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := stores.Posts.GetRevisions(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Content != "Long walks" {
+		t.Errorf("revisions = %+v, want the original version", revisions)
+	}
+
+	err = stores.Comments.PostComment(Comment{CContent: "The huts are cheap", Author: "bob", PostID: postID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stores.Comments.PostComment(Comment{CContent: "Thanks", Author: "alice", PostID: postID, ParentID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := stores.Comments.GetCommentTree(postID, 0, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 1 || len(tree[0].Replies) != 1 {
+		t.Errorf("comment tree = %+v, want one comment with one reply", tree)
+	}
+
+	if err = stores.Reactions.ReactToPost(aliceID, postID, "heart"); err != nil {
+		t.Fatal(err)
+	}
+	if err = stores.Reactions.ReactToComment(aliceID, 1, ReactionLike); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := stores.Reactions.PostReactions(aliceID, postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Counts["heart"] != 1 || summary.Viewer != "heart" {
+		t.Errorf("post reactions = %+v", summary)
+	}
+
+	post, err := stores.Posts.Get(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.CommentCount != 2 || len(post.Categories) != 1 {
+		t.Errorf("post = %+v, want 2 comments and 1 category", post)
+	}
+
+	for _, sort := range []PostSort{SortNew, SortHot, SortTop, SortComments} {
+		page, err := stores.Posts.Filter(PostFilter{Sort: sort, Period: PeriodAll}, Pagination{})
+		if err != nil {
+			t.Fatalf("sort %s: %v", sort, err)
+		}
+		if len(page.Posts) != 1 {
+			t.Errorf("sort %s: %d posts, want 1", sort, len(page.Posts))
+		}
+	}
+
+	page, err := stores.Search.Search(SearchQuery{Text: "cheap huts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 2 {
+		t.Errorf("search found %d results, want the post and a comment", len(page.Results))
+	}
+
+	// Sessions: one that ran out and two live ones, which end together.
+	var sessions [3]Session
+	for i := range sessions {
+		sessions[i] = Session{UserID: aliceID, UserName: "alice"}
+		if err = stores.Sessions.CreateSession(&sessions[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions[0].ExpirationDate = time.Now().Add(-time.Hour)
+	if err = stores.Sessions.RenewSession(&sessions[0]); err != nil {
+		t.Fatal(err)
+	}
+	n, err := stores.Sessions.DeleteExpiredSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("deleted %d expired sessions, want 1", n)
+	}
+	if err = stores.Sessions.DeleteSessionByUserId(aliceID); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sessions[1:] {
+		if _, err = stores.Sessions.GetSessionFromToken(s.Token); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("session %d: err = %v, want ErrNoRecord", s.ID, err)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
+
+	"dyelesho/forum/internal/dbs"
 )
 
 type Post struct {
@@ -11,11 +14,15 @@ type Post struct {
 	Title           string
 	Content         string
 	Created         time.Time
-	Category        string
+	Updated         time.Time
+	Categories      []string
 	UserName        string
-	Comments        []Comment
 	Likes           int
 	Dislikes        int
+	CommentCount    int
+	Reactions       map[string]int
+	ReactionList    []ReactionCount
+	ViewerReaction  string
 	IsAuthenticated bool
 }
 
@@ -24,27 +31,130 @@ type Comment struct {
 	Author          string
 	CContent        string
 	PostID          int
+	ParentID        int
+	Replies         []*Comment
 	Likes           int
 	Dislikes        int
+	Edited          time.Time
+	Deleted         bool
+	Reactions       map[string]int
+	ReactionList    []ReactionCount
+	ViewerReaction  string
 	IsAuthenticated bool
+	IsAuthor        bool
+}
+
+// PostRevision is a version of a post that has since been edited. Edited is
+// the moment it was replaced.
+type PostRevision struct {
+	ID       int
+	PostID   int
+	Title    string
+	Content  string
+	Category string
+	Edited   time.Time
 }
 
 type Model struct {
-	DB *sql.DB
+	DB *dbs.DB
 }
 
-func (m *Model) Insert(title string, content string, category string, userName string) (int, error) {
-	stmt := `INSERT INTO posts (title, content, created, category, user_name)
-    VALUES (?, ?, datetime('now'), ?, ?)`
-	result, err := m.DB.Exec(stmt, title, content, category, userName)
+func (m *Model) Insert(title string, content string, categoryIDs []int, userName string) (int, error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return 0, err
 	}
-	id, err := result.LastInsertId()
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO posts (title, content, created, user_name)
+    VALUES (?, ?, ?, ?) RETURNING id`
+	var id int
+	err = tx.QueryRow(stmt, title, content, time.Now().UTC(), userName).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
-	return int(id), nil
+	if err = setPostCategories(tx, id, categoryIDs); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func setPostCategories(tx *dbs.Tx, postID int, categoryIDs []int) error {
+	if _, err := tx.Exec(`DELETE FROM post_categories WHERE post_id = ?`, postID); err != nil {
+		return err
+	}
+	for _, categoryID := range categoryIDs {
+		_, err := tx.Exec(`INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)`, postID, categoryID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postCategoryNames returns the category names of a post in the order
+// attachCategories uses.
+func postCategoryNames(tx *dbs.Tx, postID int) ([]string, error) {
+	stmt := `SELECT c.name FROM post_categories pc
+		INNER JOIN categories c ON c.id = pc.category_id
+		WHERE pc.post_id = ? ORDER BY c.name`
+	rows, err := tx.Query(stmt, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// attachCategories loads the category names of every given post with a
+// single query.
+func (m *Model) attachCategories(posts ...*Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	byID := make(map[int]*Post, len(posts))
+	args := make([]any, 0, len(posts))
+	for _, p := range posts {
+		byID[p.ID] = p
+		args = append(args, p.ID)
+	}
+
+	stmt := `SELECT pc.post_id, c.name FROM post_categories pc
+		INNER JOIN categories c ON c.id = pc.category_id
+		WHERE pc.post_id IN (` + placeholders(len(args)) + `)
+		ORDER BY c.name`
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err = rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		byID[id].Categories = append(byID[id].Categories, name)
+	}
+	return rows.Err()
+}
+
+// placeholders returns n comma separated "?" placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
 }
 
 // func (m *Model) Get(id int) (*Post, error) {
@@ -93,114 +203,159 @@ func (m *Model) Insert(title string, content string, category string, userName s
 // 	return s, nil
 // }
 
+// Get returns a post with its categories and stored counters. The
+// reactions per kind come from ReactionStore.PostReactions and the comments
+// from CommentStore.GetCommentTree.
 func (m *Model) Get(id int) (*Post, error) {
-	stmt := `SELECT id, title, content, created, category, user_name FROM posts WHERE id = ?`
+	stmt := `SELECT id, title, content, created, updated, user_name, like_count, dislike_count, comment_count
+		FROM posts WHERE id = ?`
 	row := m.DB.QueryRow(stmt, id)
 	post := &Post{}
-	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.Created, &post.Category, &post.UserName)
+	var updated sql.NullTime
+	err := row.Scan(&post.ID, &post.Title, &post.Content, &post.Created, &updated, &post.UserName,
+		&post.Likes, &post.Dislikes, &post.CommentCount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
 		}
 		return nil, err
 	}
-
-	stmt = `SELECT COALESCE(SUM(like), 0), COALESCE(SUM(dislike), 0) FROM post_reactions WHERE post_id = ?`
-	row = m.DB.QueryRow(stmt, id)
-	err = row.Scan(&post.Likes, &post.Dislikes)
-	if err != nil {
-		return nil, err
-	}
-
-	comments, err := m.GetComments(id)
-	if err != nil {
+	post.Updated = updated.Time
+	if err = m.attachCategories(post); err != nil {
 		return nil, err
 	}
-	post.Comments = comments
-
 	return post, nil
 }
 
-func (m *Model) Latest() ([]*Post, error) {
-	stmt := `SELECT id, title, content, created, category, user_name FROM posts ORDER BY id DESC LIMIT 10`
-	rows, err := m.DB.Query(stmt)
+// Update stores the current version of the post in post_revisions and then
+// replaces it with the new title, content and categories.
+func (m *Model) Update(id int, title string, content string, categoryIDs []int) error {
+	tx, err := m.DB.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	posts := []*Post{}
-	for rows.Next() {
-		s := &Post{}
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Category, &s.UserName)
-		if err != nil {
-			return nil, err
+	defer tx.Rollback()
+
+	// The snapshot is read inside the transaction so that an edit running at
+	// the same time cannot slip in between it and the UPDATE. SQLite takes
+	// the write lock when the transaction begins; PostgreSQL needs the row
+	// locked explicitly.
+	stmt := `SELECT title, content FROM posts WHERE id = ?`
+	if tx.Dialect == dbs.Postgres {
+		stmt += ` FOR UPDATE`
+	}
+	var old Post
+	if err = tx.QueryRow(stmt, id).Scan(&old.Title, &old.Content); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
 		}
-		posts = append(posts, s)
+		return err
+	}
+	categories, err := postCategoryNames(tx, id)
+	if err != nil {
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	stmt = `INSERT INTO post_revisions (post_id, title, content, category, edited) VALUES (?, ?, ?, ?, ?)`
+	now := time.Now().UTC()
+	_, err = tx.Exec(stmt, id, old.Title, old.Content, strings.Join(categories, " "), now)
+	if err != nil {
+		return err
 	}
 
-	return posts, nil
+	stmt = `UPDATE posts SET title = ?, content = ?, updated = ? WHERE id = ?`
+	if _, err = tx.Exec(stmt, title, content, now, id); err != nil {
+		return err
+	}
+	if err = setPostCategories(tx, id, categoryIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (m *Model) ByCategory(category string) ([]*Post, error) {
-	stmt := `SELECT id, title, content, created, category, user_name FROM posts WHERE category = ? ORDER BY id DESC LIMIT 10`
-	rows, err := m.DB.Query(stmt, category)
+// Delete removes the post together with its revisions, comments and
+// reactions.
+func (m *Model) Delete(id int) error {
+	tx, err := m.DB.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	posts := []*Post{}
-	for rows.Next() {
-		s := &Post{}
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Category, &s.UserName)
-		if err != nil {
-			return nil, err
+	defer tx.Rollback()
+
+	stmts := []string{
+		`DELETE FROM comment_reactions WHERE comment_id IN (SELECT Id FROM comments WHERE PostID = ?)`,
+		`DELETE FROM comments WHERE PostID = ?`,
+		`DELETE FROM post_reactions WHERE post_id = ?`,
+		`DELETE FROM post_revisions WHERE post_id = ?`,
+		`DELETE FROM post_categories WHERE post_id = ?`,
+		`DELETE FROM attachments WHERE post_id = ?`,
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.Exec(stmt, id); err != nil {
+			return err
 		}
-		posts = append(posts, s)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+
+	result, err := tx.Exec(`DELETE FROM posts WHERE id = ?`, id)
+	if err != nil {
+		return err
 	}
-	return posts, nil
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return tx.Commit()
 }
 
-func (m *Model) GetPostsByUser(name string) ([]*Post, error) {
-	stmt := `SELECT id, title, content, created, category, user_name FROM posts WHERE user_name = ? ORDER BY id DESC`
-	rows, err := m.DB.Query(stmt, name)
+// GetRevisions returns the earlier versions of a post, oldest first.
+func (m *Model) GetRevisions(postID int) ([]PostRevision, error) {
+	stmt := `SELECT id, post_id, title, content, category, edited FROM post_revisions WHERE post_id = ? ORDER BY id`
+	rows, err := m.DB.Query(stmt, postID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	posts := []*Post{}
+	revisions := []PostRevision{}
 	for rows.Next() {
-		p := &Post{}
-		err = rows.Scan(&p.ID, &p.Title, &p.Content, &p.Created, &p.Category, &p.UserName)
+		r := PostRevision{}
+		err = rows.Scan(&r.ID, &r.PostID, &r.Title, &r.Content, &r.Category, &r.Edited)
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, p)
+		revisions = append(revisions, r)
 	}
-
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	return revisions, nil
+}
 
-	return posts, nil
+func (m *Model) Latest(p Pagination) (*PostPage, error) {
+	return m.Filter(PostFilter{}, p)
 }
 
-func (m *Model) GetComments(postID int) ([]Comment, error) {
+func (m *Model) ByCategory(category string, p Pagination) (*PostPage, error) {
+	return m.Filter(PostFilter{Categories: []string{category}}, p)
+}
+
+func (m *Model) GetPostsByUser(name string, p Pagination) (*PostPage, error) {
+	return m.Filter(PostFilter{Author: name}, p)
+}
+
+// GetComments returns the comments of a post in the order they were written,
+// with ViewerReaction set to the kind picked by the user viewerID; pass 0
+// for an anonymous viewer.
+func (m *Model) GetComments(postID int, viewerID int) ([]Comment, error) {
 	commentsQuery := `
-		SELECT c.Id, c.CContent, c.Author, c.PostID, COALESCE(SUM(r.like), 0) AS Likes, COALESCE(SUM(r.dislike), 0) AS Dislikes
+		SELECT c.Id, c.CContent, c.Author, c.PostID, COALESCE(c.parent_id, 0), c.edited_at, c.deleted_at,
+			c.like_count, c.dislike_count
 		FROM comments AS c
-		LEFT JOIN comment_reactions AS r ON c.Id = r.comment_id
 		WHERE c.PostID = ?
-		GROUP BY c.Id, c.CContent, c.Author, c.PostID
+		ORDER BY c.Id
 	`
 
 	stmt, err := m.DB.Prepare(commentsQuery)
@@ -219,10 +374,15 @@ func (m *Model) GetComments(postID int) ([]Comment, error) {
 
 	for rows.Next() {
 		comment := Comment{}
-		err = rows.Scan(&comment.Id, &comment.CContent, &comment.Author, &comment.PostID, &comment.Likes, &comment.Dislikes)
+		var edited, deleted sql.NullTime
+		err = rows.Scan(&comment.Id, &comment.CContent, &comment.Author, &comment.PostID, &comment.ParentID, &edited, &deleted,
+			&comment.Likes, &comment.Dislikes)
 		if err != nil {
 			return nil, err
 		}
+		comment.Edited = edited.Time
+		comment.Deleted = deleted.Valid
+		comment.Reactions = map[string]int{}
 
 		comments = append(comments, comment)
 	}
@@ -231,43 +391,236 @@ func (m *Model) GetComments(postID int) ([]Comment, error) {
 		return nil, err
 	}
 
+	if err = m.countCommentReactions(postID, viewerID, comments); err != nil {
+		return nil, err
+	}
 	return comments, nil
 }
 
+// countCommentReactions fills in the reaction counts of the comments of a
+// post and the reaction of the user viewerID to each of them.
+func (m *Model) countCommentReactions(postID, viewerID int, comments []Comment) error {
+	index := make(map[int]int, len(comments))
+	for i, c := range comments {
+		index[c.Id] = i
+	}
+
+	stmt := `SELECT r.comment_id, r.kind, COUNT(*), MAX(CASE WHEN r.user_id = ? THEN 1 ELSE 0 END)
+		FROM comment_reactions r
+		INNER JOIN comments c ON c.Id = r.comment_id
+		WHERE c.PostID = ? GROUP BY r.comment_id, r.kind`
+	rows, err := m.DB.Query(stmt, viewerID, postID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count, mine int
+		var kind string
+		if err = rows.Scan(&id, &kind, &count, &mine); err != nil {
+			return err
+		}
+		if i, ok := index[id]; ok {
+			comments[i].Reactions[kind] = count
+			if mine == 1 {
+				comments[i].ViewerReaction = kind
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// GetCommentTree returns the comments of a post nested under the comment
+// they reply to. See BuildCommentTree for how maxDepth is applied.
+func (m *Model) GetCommentTree(postID int, maxDepth int, viewerID int) ([]*Comment, error) {
+	comments, err := m.GetComments(postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return BuildCommentTree(comments, maxDepth), nil
+}
+
 func (m *Model) PostComment(CommentInput Comment) error {
-	if _, err := m.DB.Exec("INSERT INTO comments (CContent, Author, PostID) VALUES ($1,$2,$3)", CommentInput.CContent, CommentInput.Author, CommentInput.PostID); err != nil {
+	var parentID any
+	if CommentInput.ParentID > 0 {
+		parentID = CommentInput.ParentID
+	}
+	tx, err := m.DB.Begin()
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
+	if _, err = tx.Exec("INSERT INTO comments (CContent, Author, PostID, parent_id) VALUES (?, ?, ?, ?)", CommentInput.CContent, CommentInput.Author, CommentInput.PostID, parentID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE posts SET comment_count = comment_count + 1 WHERE id = ?`, CommentInput.PostID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Model) GetComment(id int) (*Comment, error) {
+	stmt := `SELECT Id, CContent, Author, PostID, COALESCE(parent_id, 0), edited_at, deleted_at FROM comments WHERE Id = ?`
+	comment := &Comment{}
+	var edited, deleted sql.NullTime
+	err := m.DB.QueryRow(stmt, id).Scan(&comment.Id, &comment.CContent, &comment.Author, &comment.PostID, &comment.ParentID, &edited, &deleted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	comment.Edited = edited.Time
+	comment.Deleted = deleted.Valid
+	return comment, nil
+}
+
+// UpdateComment replaces the text of a live comment and marks it as edited.
+func (m *Model) UpdateComment(id int, content string) error {
+	stmt := `UPDATE comments SET CContent = ?, edited_at = ? WHERE Id = ? AND deleted_at IS NULL`
+	result, err := m.DB.Exec(stmt, content, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
 	return nil
 }
 
-func (m *Model) GetPostsByUserReaction(userID int) ([]*Post, error) {
-	stmt := `SELECT p.id, p.title, p.content, p.created, p.category, p.user_name
-		FROM posts p
-		INNER JOIN post_reactions pr ON p.id = pr.post_id
-		WHERE pr.user_id = ? AND pr.like = 1
-		ORDER BY p.id DESC LIMIT 10`
+// DeleteComment removes a comment. A comment that others replied to becomes
+// a tombstone: its text and reactions are removed but the row stays so the
+// replies keep their place in the thread. Anything else is deleted for good
+// together with its reactions, and so is every tombstone left without
+// replies as a result.
+func (m *Model) DeleteComment(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	rows, err := m.DB.Query(stmt, userID)
+	var postID, parentID int
+	var deleted sql.NullTime
+	err = tx.QueryRow(`SELECT PostID, COALESCE(parent_id, 0), deleted_at FROM comments WHERE Id = ?`, id).Scan(&postID, &parentID, &deleted)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	if deleted.Valid {
+		return ErrNoRecord
 	}
-	defer rows.Close()
 
-	posts := []*Post{}
-	for rows.Next() {
-		p := &Post{}
-		err = rows.Scan(&p.ID, &p.Title, &p.Content, &p.Created, &p.Category, &p.UserName)
+	// Tombstones are not counted, so whichever way the comment goes the
+	// post has one comment less.
+	if _, err = tx.Exec(`UPDATE posts SET comment_count = comment_count - 1 WHERE id = ?`, postID); err != nil {
+		return err
+	}
+
+	replies, err := countReplies(tx, id)
+	if err != nil {
+		return err
+	}
+	if replies > 0 {
+		stmt := `UPDATE comments SET CContent = '', deleted_at = ?, like_count = 0, dislike_count = 0 WHERE Id = ?`
+		if _, err = tx.Exec(stmt, time.Now().UTC(), id); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM comment_reactions WHERE comment_id = ?`, id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	for id != 0 {
+		if _, err = tx.Exec(`DELETE FROM comment_reactions WHERE comment_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM comments WHERE Id = ?`, id); err != nil {
+			return err
+		}
+		if parentID == 0 {
+			break
+		}
+
+		// Climb to the parent and remove it as well if it is a tombstone
+		// that no longer has any replies.
+		id = 0
+		var grandparentID int
+		err = tx.QueryRow(`SELECT COALESCE(parent_id, 0), deleted_at FROM comments WHERE Id = ?`, parentID).Scan(&grandparentID, &deleted)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if !deleted.Valid {
+			break
+		}
+		replies, err = countReplies(tx, parentID)
+		if err != nil {
+			return err
+		}
+		if replies == 0 {
+			id, parentID = parentID, grandparentID
 		}
-		posts = append(posts, p)
 	}
+	return tx.Commit()
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+// RepairCounters recomputes the like, dislike and comment counters of posts
+// and comments from the rows they count and returns how many rows were off.
+// Writes keep the counters up to date; this catches whatever slipped past,
+// such as reactions removed together with their user.
+func (m *Model) RepairCounters() (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	likes := `(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = posts.id AND r.kind = ?)`
+	dislikes := `(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = posts.id AND r.kind = ?)`
+	comments := `(SELECT COUNT(*) FROM comments c WHERE c.PostID = posts.id AND c.deleted_at IS NULL)`
+	stmt := `UPDATE posts SET like_count = ` + likes + `, dislike_count = ` + dislikes + `, comment_count = ` + comments + `
+		WHERE like_count <> ` + likes + ` OR dislike_count <> ` + dislikes + ` OR comment_count <> ` + comments
+	result, err := tx.Exec(stmt, ReactionLike, ReactionDislike, ReactionLike, ReactionDislike)
+	if err != nil {
+		return 0, err
+	}
+	fixed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
 
-	return posts, nil
+	likes = `(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = comments.Id AND r.kind = ?)`
+	dislikes = `(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = comments.Id AND r.kind = ?)`
+	stmt = `UPDATE comments SET like_count = ` + likes + `, dislike_count = ` + dislikes + `
+		WHERE like_count <> ` + likes + ` OR dislike_count <> ` + dislikes
+	result, err = tx.Exec(stmt, ReactionLike, ReactionDislike, ReactionLike, ReactionDislike)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(fixed + n), tx.Commit()
+}
+
+func countReplies(tx *dbs.Tx, id int) (int, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM comments WHERE parent_id = ?`, id).Scan(&n)
+	return n, err
+}
+
+func (m *Model) GetPostsByUserReaction(userID int, p Pagination) (*PostPage, error) {
+	return m.Filter(PostFilter{LikedBy: userID}, p)
 }
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Edits running at the same time must each record the version they
+// replaced, so that no version goes missing from the history.
+func TestUpdateConcurrently(t *testing.T) {
+	db := newTestDB(t)
+	posts := &Model{DB: db}
+
+	postID, err := posts.Insert("Title", "Content", []int{1}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const numWriters, numEdits = 8, 80
+	var wg sync.WaitGroup
+	errs := make(chan error, numWriters)
+	for w := 0; w < numWriters; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < numEdits; i += numWriters {
+				if err := posts.Update(postID, "Title", fmt.Sprint("Content ", i), []int{1 + i%2}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	revisions, err := posts.GetRevisions(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := posts.Get(postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != numEdits {
+		t.Fatalf("%d revisions, want %d", len(revisions), numEdits)
+	}
+
+	seen := map[string]int{post.Content: 1}
+	for _, r := range revisions {
+		seen[r.Content]++
+	}
+	for i := -1; i < numEdits; i++ {
+		content := "Content"
+		if i >= 0 {
+			content = fmt.Sprint("Content ", i)
+		}
+		if seen[content] != 1 {
+			t.Errorf("%q appears %d times in the history, want once", content, seen[content])
+		}
+	}
+	if revisions[0].Content != "Content" {
+		t.Errorf("first revision = %q, want the original content", revisions[0].Content)
+	}
+}
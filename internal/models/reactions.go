@@ -3,136 +3,264 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"dyelesho/forum/internal/dbs"
 )
 
-type ReactionModel struct {
-	DB *sql.DB
+// The kinds that replaced the old like and dislike columns. Likes and
+// Dislikes on posts and comments count them.
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+// ReactionKind is a reaction users can give. Name is what is stored.
+type ReactionKind struct {
+	Name  string
+	Emoji string
+	Label string
 }
 
-func (r *ReactionModel) LikePost(userID, postID int) error {
-	stmt := `SELECT like, dislike FROM post_reactions WHERE post_id = ? AND user_id = ?`
-	var like, dislike int
-	err := r.DB.QueryRow(stmt, postID, userID).Scan(&like, &dislike)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			_, err = r.DB.Exec(`INSERT INTO post_reactions (post_id, user_id, like, dislike) VALUES (?, ?, ?, ?)`, postID, userID, 1, 0)
-			if err != nil {
-				return err
+// ReactionKinds lists the kinds the forum knows about, in display order.
+var ReactionKinds = []ReactionKind{
+	{Name: ReactionLike, Emoji: "👍", Label: "Like"},
+	{Name: ReactionDislike, Emoji: "👎", Label: "Dislike"},
+	{Name: "heart", Emoji: "❤️", Label: "Love"},
+	{Name: "laugh", Emoji: "😂", Label: "Funny"},
+	{Name: "tada", Emoji: "🎉", Label: "Celebrate"},
+	{Name: "thinking", Emoji: "🤔", Label: "Thinking"},
+}
+
+var reactionNameRX = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+// ParseReactionKinds reads a comma-separated list of reaction kinds. Each
+// item is either the name of one of ReactionKinds or a new kind written as
+// name=emoji.
+func ParseReactionKinds(s string) ([]ReactionKind, error) {
+	var kinds []ReactionKind
+	seen := map[string]bool{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		var kind ReactionKind
+		if name, emoji, ok := strings.Cut(item, "="); ok {
+			kind = ReactionKind{Name: strings.TrimSpace(name), Emoji: strings.TrimSpace(emoji), Label: strings.TrimSpace(name)}
+			if kind.Emoji == "" {
+				return nil, fmt.Errorf("reaction %q has no emoji", kind.Name)
 			}
 		} else {
-			return err
-		}
-	}
-	if like == 1 {
-		_, err := r.DB.Exec(`DELETE FROM post_reactions WHERE post_id = ? AND user_id = ?`, postID, userID)
-		if err != nil {
-			return err
+			for _, known := range ReactionKinds {
+				if known.Name == item {
+					kind = known
+				}
+			}
+			if kind.Name == "" {
+				return nil, fmt.Errorf("unknown reaction %q, use name=emoji to add one", item)
+			}
 		}
-	} else if dislike == 1 {
-		_, err := r.DB.Exec(`UPDATE post_reactions SET dislike = ? WHERE post_id = ? AND user_id = ?`, 0, postID, userID)
-		if err != nil {
-			return err
+
+		if !reactionNameRX.MatchString(kind.Name) {
+			return nil, fmt.Errorf("invalid reaction name %q", kind.Name)
 		}
-		_, err = r.DB.Exec(`UPDATE post_reactions SET like = ? WHERE post_id = ? AND user_id = ?`, 1, postID, userID)
-		if err != nil {
-			return err
+		if seen[kind.Name] {
+			return nil, fmt.Errorf("reaction %q is listed twice", kind.Name)
 		}
+		seen[kind.Name] = true
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no reactions configured")
 	}
-	return nil
+	return kinds, nil
 }
 
-func (r *ReactionModel) DislikePost(userID, postID int) error {
-	stmt := `SELECT like, dislike FROM post_reactions WHERE post_id = ? AND user_id = ?`
-	var like, dislike int
-	err := r.DB.QueryRow(stmt, postID, userID).Scan(&like, &dislike)
+// ReactionCount is the number of reactions of one kind to a post or a
+// comment.
+type ReactionCount struct {
+	ReactionKind
+	Count int
+}
+
+// CountReactions lists the counts for kinds, in their order, including the
+// kinds nobody picked.
+func CountReactions(kinds []ReactionKind, counts map[string]int) []ReactionCount {
+	list := make([]ReactionCount, len(kinds))
+	for i, kind := range kinds {
+		list[i] = ReactionCount{ReactionKind: kind, Count: counts[kind.Name]}
+	}
+	return list
+}
+
+// ReactionSummary sums up the reactions to a post or a comment. Counts is
+// keyed by kind name. Viewer is the kind picked by the user the summary was
+// read for, or "" if none.
+type ReactionSummary struct {
+	Counts map[string]int
+	Viewer string
+}
+
+// Reactor is a user who reacted to a post or a comment.
+type Reactor struct {
+	UserName string
+	Kind     string
+	Created  time.Time
+}
+
+type ReactionModel struct {
+	DB *dbs.DB
+}
+
+func (r *ReactionModel) ReactToPost(userID, postID int, kind string) error {
+	return r.toggle("post_reactions", "post_id", "posts", userID, postID, kind)
+}
+
+func (r *ReactionModel) ReactToComment(userID, commentID int, kind string) error {
+	return r.toggle("comment_reactions", "comment_id", "comments", userID, commentID, kind)
+}
+
+// toggle gives a user's reaction to a target. Each user has at most one
+// reaction per target: picking another kind replaces it and picking the
+// same kind again takes it back. The like and dislike counters on the
+// target's row in parent follow in the same transaction. ErrNoRecord is
+// returned when parent has no such row.
+//
+// The old reaction is deleted and the new one inserted rather than updated
+// in place so that the old kind is known. When a concurrent toggle wins the
+// insert, the primary key on (user_id, target) turns this one into a no-op
+// and the counters stay in step with the rows.
+func (r *ReactionModel) toggle(table, target, parent string, userID, targetID int, kind string) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM `+parent+` WHERE id = ?`, targetID).Scan(&exists)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			_, err = r.DB.Exec(`INSERT INTO post_reactions (post_id, user_id, like, dislike) VALUES (?, ?, ?, ?)`, postID, userID, 0, 1)
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
+			return ErrNoRecord
 		}
+		return err
 	}
-	if dislike == 1 {
-		_, err := r.DB.Exec(`DELETE FROM post_reactions WHERE post_id = ? AND user_id = ?`, postID, userID)
+
+	var old string
+	stmt := `DELETE FROM ` + table + ` WHERE user_id = ? AND ` + target + ` = ? RETURNING kind`
+	err = tx.QueryRow(stmt, userID, targetID).Scan(&old)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	likes, dislikes := countDelta(old, -1)
+
+	if old != kind {
+		stmt = `INSERT INTO ` + table + ` (user_id, ` + target + `, kind, created) VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, ` + target + `) DO NOTHING`
+		result, err := tx.Exec(stmt, userID, targetID, kind, time.Now().UTC())
 		if err != nil {
 			return err
 		}
-	} else if like == 1 {
-		_, err := r.DB.Exec(`UPDATE post_reactions SET like = ? WHERE post_id = ? AND user_id = ?`, 0, postID, userID)
+		n, err := result.RowsAffected()
 		if err != nil {
 			return err
 		}
-		_, err = r.DB.Exec(`UPDATE post_reactions SET dislike = ? WHERE post_id = ? AND user_id = ?`, 1, postID, userID)
-		if err != nil {
+		if n == 1 {
+			l, d := countDelta(kind, 1)
+			likes, dislikes = likes+l, dislikes+d
+		}
+	}
+
+	if likes != 0 || dislikes != 0 {
+		stmt = `UPDATE ` + parent + ` SET like_count = like_count + ?, dislike_count = dislike_count + ? WHERE id = ?`
+		if _, err = tx.Exec(stmt, likes, dislikes, targetID); err != nil {
 			return err
 		}
 	}
-	return nil
+	return tx.Commit()
 }
 
-func (r *ReactionModel) LikeComment(userID, commentID int) error {
-	stmt := `SELECT like, dislike FROM comment_reactions WHERE comment_id = ? AND user_id = ?`
-	var like, dislike int
-	err := r.DB.QueryRow(stmt, commentID, userID).Scan(&like, &dislike)
+// countDelta returns how the like and dislike counters change when a
+// reaction of kind is added (by 1) or removed (by -1).
+func countDelta(kind string, by int) (likes, dislikes int) {
+	switch kind {
+	case ReactionLike:
+		return by, 0
+	case ReactionDislike:
+		return 0, by
+	}
+	return 0, 0
+}
+
+func (r *ReactionModel) PostReactions(userID, postID int) (*ReactionSummary, error) {
+	return r.summary("post_reactions", "post_id", userID, postID)
+}
+
+func (r *ReactionModel) CommentReactions(userID, commentID int) (*ReactionSummary, error) {
+	return r.summary("comment_reactions", "comment_id", userID, commentID)
+}
+
+func (r *ReactionModel) summary(table, target string, userID, targetID int) (*ReactionSummary, error) {
+	stmt := `SELECT kind, COUNT(*), MAX(CASE WHEN user_id = ? THEN 1 ELSE 0 END)
+		FROM ` + table + ` WHERE ` + target + ` = ? GROUP BY kind`
+	rows, err := r.DB.Query(stmt, userID, targetID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			_, err = r.DB.Exec(`INSERT INTO comment_reactions (comment_id, user_id, like, dislike) VALUES (?, ?, ?, ?)`, commentID, userID, 1, 0)
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
+		return nil, err
 	}
-	if like == 1 {
-		_, err := r.DB.Exec(`DELETE FROM comment_reactions WHERE comment_id = ? AND user_id = ?`, commentID, userID)
-		if err != nil {
-			return err
-		}
-	} else if dislike == 1 {
-		_, err := r.DB.Exec(`UPDATE comment_reactions SET dislike = ? WHERE comment_id = ? AND user_id = ?`, 0, commentID, userID)
-		if err != nil {
-			return err
+	defer rows.Close()
+
+	s := &ReactionSummary{Counts: map[string]int{}}
+	for rows.Next() {
+		var kind string
+		var count, mine int
+		if err = rows.Scan(&kind, &count, &mine); err != nil {
+			return nil, err
 		}
-		_, err = r.DB.Exec(`UPDATE comment_reactions SET like = ? WHERE comment_id = ? AND user_id = ?`, 1, commentID, userID)
-		if err != nil {
-			return err
+		s.Counts[kind] = count
+		if mine == 1 {
+			s.Viewer = kind
 		}
 	}
-	return nil
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *ReactionModel) PostReactors(postID int) ([]Reactor, error) {
+	return r.reactors("post_reactions", "post_id", postID)
 }
 
-func (r *ReactionModel) DislikeComment(userID, commentID int) error {
-	stmt := `SELECT like, dislike FROM comment_reactions WHERE comment_id = ? AND user_id = ?`
-	var like, dislike int
-	err := r.DB.QueryRow(stmt, commentID, userID).Scan(&like, &dislike)
+func (r *ReactionModel) CommentReactors(commentID int) ([]Reactor, error) {
+	return r.reactors("comment_reactions", "comment_id", commentID)
+}
+
+// reactors lists who reacted to a target, earliest first.
+func (r *ReactionModel) reactors(table, target string, targetID int) ([]Reactor, error) {
+	stmt := `SELECT u.name, r.kind, r.created FROM ` + table + ` r
+		INNER JOIN users u ON u.id = r.user_id
+		WHERE r.` + target + ` = ? ORDER BY r.created, u.name`
+	rows, err := r.DB.Query(stmt, targetID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			_, err = r.DB.Exec(`INSERT INTO comment_reactions (comment_id, user_id, like, dislike) VALUES (?, ?, ?, ?)`, commentID, userID, 0, 1)
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
+		return nil, err
 	}
-	if dislike == 1 {
-		_, err := r.DB.Exec(`DELETE FROM comment_reactions WHERE comment_id = ? AND user_id = ?`, commentID, userID)
-		if err != nil {
-			return err
-		}
-	} else if like == 1 {
-		_, err := r.DB.Exec(`UPDATE comment_reactions SET like = ? WHERE comment_id = ? AND user_id = ?`, 0, commentID, userID)
-		if err != nil {
-			return err
-		}
-		_, err = r.DB.Exec(`UPDATE comment_reactions SET dislike = ? WHERE comment_id = ? AND user_id = ?`, 1, commentID, userID)
-		if err != nil {
-			return err
+	defer rows.Close()
+
+	reactors := []Reactor{}
+	for rows.Next() {
+		var re Reactor
+		if err = rows.Scan(&re.UserName, &re.Kind, &re.Created); err != nil {
+			return nil, err
 		}
+		reactors = append(reactors, re)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	return nil
+	return reactors, nil
 }
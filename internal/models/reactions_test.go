@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Toggling from many goroutines at once, as double clicks and retried
+// requests do, must leave one reaction per user and target at most, with
+// the counters matching the rows.
+func TestToggleConcurrently(t *testing.T) {
+	db := newTestDB(t)
+	posts := &Model{DB: db}
+	users := &UserModel{DB: db}
+	reactions := &ReactionModel{DB: db}
+
+	const numUsers = 4
+	for i := 1; i <= numUsers; i++ {
+		if err := users.Insert(fmt.Sprint("user", i), fmt.Sprintf("user%d@example.com", i), "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	postID, err := posts.Insert("Title", "Content", []int{1}, "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = posts.PostComment(Comment{CContent: "Comment", Author: "user1", PostID: postID}); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := []string{ReactionLike, ReactionDislike, "heart"}
+	var wg sync.WaitGroup
+	errs := make(chan error, numUsers*8)
+	for userID := 1; userID <= numUsers; userID++ {
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(userID, g int) {
+				defer wg.Done()
+				for i := 0; i < 15; i++ {
+					kind := kinds[(g+i)%len(kinds)]
+					if err := reactions.ReactToPost(userID, postID, kind); err != nil {
+						errs <- err
+						return
+					}
+					if err := reactions.ReactToComment(userID, 1, kind); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(userID, g)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for _, tt := range []struct{ table, target, parent string }{
+		{"post_reactions", "post_id", "posts"},
+		{"comment_reactions", "comment_id", "comments"},
+	} {
+		var duplicates int
+		stmt := `SELECT COUNT(*) FROM (SELECT user_id FROM ` + tt.table + ` GROUP BY user_id, ` + tt.target + ` HAVING COUNT(*) > 1)`
+		if err = db.QueryRow(stmt).Scan(&duplicates); err != nil {
+			t.Fatal(err)
+		}
+		if duplicates != 0 {
+			t.Errorf("%s: %d users reacted more than once", tt.table, duplicates)
+		}
+
+		var likes, dislikes, likeRows, dislikeRows int
+		stmt = `SELECT like_count, dislike_count,
+			(SELECT COUNT(*) FROM ` + tt.table + ` WHERE ` + tt.target + ` = 1 AND kind = 'like'),
+			(SELECT COUNT(*) FROM ` + tt.table + ` WHERE ` + tt.target + ` = 1 AND kind = 'dislike')
+			FROM ` + tt.parent + ` WHERE id = 1`
+		if err = db.QueryRow(stmt).Scan(&likes, &dislikes, &likeRows, &dislikeRows); err != nil {
+			t.Fatal(err)
+		}
+		if likes != likeRows || dislikes != dislikeRows {
+			t.Errorf("%s: counters say %d likes and %d dislikes, the rows %d and %d",
+				tt.parent, likes, dislikes, likeRows, dislikeRows)
+		}
+	}
+}
+
+func TestReactToMissingTarget(t *testing.T) {
+	db := newTestDB(t)
+	reactions := &ReactionModel{DB: db}
+	if err := (&UserModel{DB: db}).Insert("alice", "alice@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reactions.ReactToPost(1, 99, ReactionLike); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("ReactToPost: err = %v, want ErrNoRecord", err)
+	}
+	if err := reactions.ReactToComment(1, 99, ReactionLike); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("ReactToComment: err = %v, want ErrNoRecord", err)
+	}
+}
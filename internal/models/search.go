@@ -0,0 +1,226 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"dyelesho/forum/internal/dbs"
+)
+
+// Snippets come back from the database with matches wrapped in these
+// private use characters, which are then split into SnippetParts.
+const (
+	snippetStart = "\ue000"
+	snippetStop  = "\ue001"
+)
+
+// SearchQuery describes a full-text search. Zero fields do not filter.
+type SearchQuery struct {
+	Text     string
+	Author   string
+	Category string
+	// From and To bound the creation time of the post, To exclusive.
+	From time.Time
+	To   time.Time
+	// Page counts from 1.
+	Page int
+}
+
+// SearchResult is a post or a comment matching a search. CommentID is zero
+// for posts.
+type SearchResult struct {
+	PostID    int
+	CommentID int
+	Title     string
+	Author    string
+	Created   time.Time
+	Snippet   []SnippetPart
+	Rank      float64
+}
+
+// SnippetPart is a piece of a result snippet. Match marks the search terms.
+type SnippetPart struct {
+	Text  string
+	Match bool
+}
+
+type SearchPage struct {
+	Results []SearchResult
+	Page    int
+	HasPrev bool
+	HasNext bool
+}
+
+type SearchModel struct {
+	DB *dbs.DB
+}
+
+// Search returns one page of posts and comments matching q, best match
+// first. Comments that were deleted are never returned.
+func (m *SearchModel) Search(q SearchQuery) (*SearchPage, error) {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	page := &SearchPage{Page: q.Page, HasPrev: q.Page > 1, Results: []SearchResult{}}
+	if strings.TrimSpace(q.Text) == "" {
+		return page, nil
+	}
+
+	indexed, err := m.indexed()
+	if err != nil {
+		return nil, err
+	}
+
+	var hits string
+	var args []any
+	switch {
+	case m.DB.Dialect == dbs.Postgres:
+		// ts_rank grows with relevance, negate it to sort like bm25.
+		options := "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", MaxFragments=2, MaxWords=24, MinWords=8"
+		hits = `SELECT p.id AS post_id, 0 AS comment_id, p.user_name AS author,
+				ts_headline('english', p.content, q, ?) AS snippet, -ts_rank(p.search, q) AS rank
+			FROM posts p, websearch_to_tsquery('english', ?) q WHERE p.search @@ q
+			UNION ALL
+			SELECT c.postid, c.id, c.author, ts_headline('english', c.ccontent, q, ?), -ts_rank(c.search, q)
+			FROM comments c, websearch_to_tsquery('english', ?) q
+			WHERE c.search @@ q AND c.deleted_at IS NULL`
+		args = []any{options, q.Text, options, q.Text}
+	case indexed:
+		match := ftsQuery(q.Text)
+		// Title matches weigh twice as much as body matches.
+		hits = `SELECT posts_fts.rowid AS post_id, 0 AS comment_id, p.user_name AS author,
+				snippet(posts_fts, -1, ?, ?, '…', 16) AS snippet, bm25(posts_fts, 2.0, 1.0) AS rank
+			FROM posts_fts INNER JOIN posts p ON p.id = posts_fts.rowid
+			WHERE posts_fts MATCH ?
+			UNION ALL
+			SELECT c.PostID, c.Id, c.Author, snippet(comments_fts, 0, ?, ?, '…', 16), bm25(comments_fts)
+			FROM comments_fts INNER JOIN comments c ON c.Id = comments_fts.rowid
+			WHERE comments_fts MATCH ? AND c.deleted_at IS NULL`
+		args = []any{snippetStart, snippetStop, match, snippetStart, snippetStop, match}
+	default:
+		// Without the index every word has to appear somewhere in the
+		// text. Nothing is ranked and snippets are the start of the text.
+		var postConds, commentConds []string
+		var postArgs, commentArgs []any
+		for _, word := range strings.Fields(q.Text) {
+			pattern := "%" + likeEscaper.Replace(word) + "%"
+			postConds = append(postConds, `(p.title LIKE ? ESCAPE '\' OR p.content LIKE ? ESCAPE '\')`)
+			postArgs = append(postArgs, pattern, pattern)
+			commentConds = append(commentConds, `c.CContent LIKE ? ESCAPE '\'`)
+			commentArgs = append(commentArgs, pattern)
+		}
+		commentConds = append(commentConds, `c.deleted_at IS NULL`)
+		hits = `SELECT p.id AS post_id, 0 AS comment_id, p.user_name AS author,
+				substr(p.content, 1, 160) AS snippet, 0.0 AS rank
+			FROM posts p` + where(postConds) + `
+			UNION ALL
+			SELECT c.PostID, c.Id, c.Author, substr(c.CContent, 1, 160), 0.0
+			FROM comments c` + where(commentConds)
+		args = append(postArgs, commentArgs...)
+	}
+
+	var conds []string
+	if q.Author != "" {
+		conds = append(conds, `h.author = ?`)
+		args = append(args, q.Author)
+	}
+	if q.Category != "" {
+		conds = append(conds, `EXISTS (SELECT 1 FROM post_categories pc
+			INNER JOIN categories c ON c.id = pc.category_id
+			WHERE pc.post_id = p.id AND c.name = ?)`)
+		args = append(args, q.Category)
+	}
+	if !q.From.IsZero() {
+		conds = append(conds, `p.created >= ?`)
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		conds = append(conds, `p.created < ?`)
+		args = append(args, q.To.UTC())
+	}
+
+	stmt := `SELECT h.post_id, h.comment_id, p.title, h.author, p.created, h.snippet, h.rank
+		FROM (` + hits + `) h INNER JOIN posts p ON p.id = h.post_id` + where(conds) + `
+		ORDER BY h.rank, p.created DESC LIMIT ? OFFSET ?`
+	args = append(args, DefaultPageSize+1, (q.Page-1)*DefaultPageSize)
+
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r SearchResult
+		var author, snippet *string
+		err = rows.Scan(&r.PostID, &r.CommentID, &r.Title, &author, &r.Created, &snippet, &r.Rank)
+		if err != nil {
+			return nil, err
+		}
+		if author != nil {
+			r.Author = *author
+		}
+		if snippet != nil {
+			r.Snippet = splitSnippet(*snippet)
+		}
+		page.Results = append(page.Results, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Results) > DefaultPageSize {
+		page.Results = page.Results[:DefaultPageSize]
+		page.HasNext = true
+	}
+	return page, nil
+}
+
+// indexed reports whether SQLite search can use the FTS5 index. There is
+// none when the database was migrated by a build without FTS5.
+func (m *SearchModel) indexed() (bool, error) {
+	if m.DB.Dialect != dbs.SQLite || !m.DB.FTS5 {
+		return false, nil
+	}
+	var n int
+	err := m.DB.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'posts_fts'`).Scan(&n)
+	return n > 0, err
+}
+
+// likeEscaper escapes the LIKE wildcards for use with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ftsQuery turns free text into an FTS5 query that matches documents
+// containing every word. Each word is quoted so that FTS5 operators and
+// punctuation in the input are taken literally.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		word = strings.ReplaceAll(word, `"`, `""`)
+		terms = append(terms, `"`+word+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// splitSnippet cuts a snippet with marked matches into parts.
+func splitSnippet(s string) []SnippetPart {
+	var parts []SnippetPart
+	for s != "" {
+		start := strings.Index(s, snippetStart)
+		if start < 0 {
+			parts = append(parts, SnippetPart{Text: s})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, SnippetPart{Text: s[:start]})
+		}
+		s = s[start+len(snippetStart):]
+		stop := strings.Index(s, snippetStop)
+		if stop < 0 {
+			stop = len(s)
+		}
+		parts = append(parts, SnippetPart{Text: s[:stop], Match: true})
+		s = strings.TrimPrefix(s[stop:], snippetStop)
+	}
+	return parts
+}
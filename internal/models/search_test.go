@@ -0,0 +1,124 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"dyelesho/forum/internal/dbs"
+)
+
+func TestSearch(t *testing.T) {
+	db := newTestDB(t)
+	posts := &Model{DB: db}
+	search := &SearchModel{DB: db}
+
+	first, err := posts.Insert("Hiking in the Alps", "Long walks and cheap huts", []int{2}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := posts.Insert("Cheap flights", "Booking 100% refundable tickets", []int{2}, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"The huts are cheap in June", "Deleted hiking tip"} {
+		if err = posts.PostComment(Comment{CContent: c, Author: "bob", PostID: first}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = posts.DeleteComment(2); err != nil {
+		t.Fatal(err)
+	}
+
+	type hit struct{ post, comment int }
+	tests := []struct {
+		name string
+		q    SearchQuery
+		want []hit
+	}{
+		{"blank", SearchQuery{Text: "  "}, nil},
+		{"title", SearchQuery{Text: "alps"}, []hit{{first, 0}}},
+		{"every word", SearchQuery{Text: "cheap huts"}, []hit{{first, 0}, {first, 1}}},
+		{"deleted comment", SearchQuery{Text: "tip"}, nil},
+		{"author", SearchQuery{Text: "cheap", Author: "bob"}, []hit{{second, 0}, {first, 1}}},
+		{"category", SearchQuery{Text: "cheap", Category: "Technology"}, nil},
+		{"wildcards are literal", SearchQuery{Text: "100%"}, []hit{{second, 0}}},
+		{"no match", SearchQuery{Text: "camping"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := search.Search(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[hit]bool{}
+			for _, r := range page.Results {
+				got[hit{r.PostID, r.CommentID}] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for _, h := range tt.want {
+				if !got[h] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// A database migrated by a build without FTS5 gets its search index once a
+// build with FTS5 migrates it. Run with -tags sqlite_fts5.
+func TestSearchIndexCatchUp(t *testing.T) {
+	if !openTestDB(t).FTS5 {
+		t.Skip("SQLite was built without FTS5")
+	}
+
+	tests := []struct {
+		name    string
+		migrate func(t *testing.T, db *dbs.DB)
+	}{
+		// Migrations 8 and 17 stay pending and run later.
+		{"pending", func(t *testing.T, db *dbs.DB) {
+			migrateTestDB(t, db, 0)
+		}},
+		// Earlier releases recorded migration 8 without running it, which
+		// migration 17 makes up for.
+		{"recorded", func(t *testing.T, db *dbs.DB) {
+			migrateTestDB(t, db, 7)
+			_, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (8, 'add_search_index', ?)`, time.Now().UTC())
+			if err != nil {
+				t.Fatal(err)
+			}
+			migrateTestDB(t, db, 16)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			posts := &Model{DB: db}
+			search := &SearchModel{DB: db}
+
+			db.FTS5 = false
+			tt.migrate(t, db)
+			if _, err := posts.Insert("Hiking in the Alps", "Long walks", []int{2}, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			if indexed, err := search.indexed(); err != nil || indexed {
+				t.Fatalf("indexed() = %v, %v after migrating without FTS5", indexed, err)
+			}
+
+			db.FTS5 = true
+			migrateTestDB(t, db, 0)
+			if indexed, err := search.indexed(); err != nil || !indexed {
+				t.Fatalf("indexed() = %v, %v after migrating with FTS5", indexed, err)
+			}
+			page, err := search.Search(SearchQuery{Text: "alps"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Results) != 1 {
+				t.Errorf("%d results, want the post written before the index", len(page.Results))
+			}
+		})
+	}
+}
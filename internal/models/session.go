@@ -1,59 +1,198 @@
 package models
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
-	"github.com/google/uuid"
+	"dyelesho/forum/internal/dbs"
 )
 
+// SessionLifetime is how long a session lasts without any activity.
+// RememberLifetime is the same for sessions started with "remember me".
+// Every request made with a session pushes its expiry back, see Renewal.
+const (
+	SessionLifetime  = 20 * time.Minute
+	RememberLifetime = 30 * 24 * time.Hour
+)
+
+// renewInterval keeps busy sessions from writing to the store on every
+// request.
+const renewInterval = time.Minute
+
+// Session is one signed in browser. Created, LastSeen, IP and UserAgent
+// let users tell their sessions apart; LastSeen, IP and UserAgent are
+// brought up to date whenever the session is renewed.
 type Session struct {
+	ID             int
 	UserID         int
 	UserName       string
 	Token          string
 	ExpirationDate time.Time
+	Remember       bool
+	Created        time.Time
+	LastSeen       time.Time
+	IP             string
+	UserAgent      string
+}
+
+// Lifetime returns how long s lasts without activity.
+func (s *Session) Lifetime() time.Duration {
+	if s.Remember {
+		return RememberLifetime
+	}
+	return SessionLifetime
+}
+
+// Renewal returns the expiry s gets for activity at now, and whether it has
+// moved far enough to be worth storing.
+func (s *Session) Renewal(now time.Time) (time.Time, bool) {
+	expires := now.Add(s.Lifetime())
+	return expires, expires.Sub(s.ExpirationDate) >= renewInterval
+}
+
+// NewToken returns a random session token for the cookie.
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func (m *Model) CreateSession(userId int, userName string) (string, time.Time, error) {
-	token := uuid.NewString()
-	date := time.Now().Add(20 * time.Minute)
-	stmt := `INSERT INTO Sessions ( user_id, user_name, token, expiration_date) 
-			VALUES(?,?,?,?)`
-	_, err := m.DB.Exec(stmt, userId, userName, token, date)
+// HashToken returns what the stores keep instead of the token itself, so
+// that a leaked copy of the database cannot be used to sign in.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type SessionModel struct {
+	DB *dbs.DB
+}
+
+// CreateSession stores a new session for session.UserID and fills in its
+// ID, token and times. Only the hash of the token is stored.
+func (m *SessionModel) CreateSession(session *Session) error {
+	token, err := NewToken()
 	if err != nil {
-		return "", date, err
+		return err
 	}
-	return token, date, nil
+	now := time.Now().UTC()
+	session.Token = token
+	session.Created = now
+	session.LastSeen = now
+	session.ExpirationDate = now.Add(session.Lifetime())
+
+	stmt := `INSERT INTO Sessions (user_id, user_name, token_hash, expiration_date, remember, created, last_seen, ip, user_agent)
+			VALUES(?,?,?,?,?,?,?,?,?) RETURNING session_id`
+	return m.DB.QueryRow(stmt, session.UserID, session.UserName, HashToken(token), session.ExpirationDate,
+		session.Remember, now, now, session.IP, session.UserAgent).Scan(&session.ID)
 }
 
-func (m *Model) GetSessionFromToken(token string) (*Session, error) {
-	stmt := `SELECT user_id, user_name, token, expiration_date FROM Sessions  where token = ?`
+// sessionColumns are read by scanSession.
+const sessionColumns = `session_id, user_id, user_name, expiration_date, remember, created, last_seen, ip, user_agent`
 
-	row := m.DB.QueryRow(stmt, token)
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
 	session := &Session{}
-	err := row.Scan(&session.UserID, &session.UserName, &session.Token, &session.ExpirationDate)
+	var created, lastSeen sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.UserName, &session.ExpirationDate, &session.Remember,
+		&created, &lastSeen, &session.IP, &session.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	session.Created = created.Time
+	session.LastSeen = lastSeen.Time
+	return session, nil
+}
+
+// GetSessionFromToken returns the session for token. Expired sessions are
+// reported as ErrNoRecord.
+func (m *SessionModel) GetSessionFromToken(token string) (*Session, error) {
+	stmt := `SELECT ` + sessionColumns + ` FROM Sessions WHERE token_hash = ? AND expiration_date > ?`
+	session, err := scanSession(m.DB.QueryRow(stmt, HashToken(token), time.Now().UTC()))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
 		}
 		return nil, err
 	}
+	session.Token = token
 	return session, nil
 }
 
-func (m *Model) DeleteSessionByUserId(userId int) error {
-	_, err := m.DB.Exec("DELETE FROM Sessions WHERE user_id = $1", userId)
+// RenewSession stores the expiry, last seen time, IP and user agent of
+// session.
+func (m *SessionModel) RenewSession(session *Session) error {
+	stmt := `UPDATE Sessions SET expiration_date = ?, last_seen = ?, ip = ?, user_agent = ? WHERE session_id = ?`
+	_, err := m.DB.Exec(stmt, session.ExpirationDate.UTC(), session.LastSeen.UTC(), session.IP, session.UserAgent, session.ID)
+	return err
+}
+
+// UserSessions returns the live sessions of a user, most recently used
+// first.
+func (m *SessionModel) UserSessions(userID int) ([]Session, error) {
+	stmt := `SELECT ` + sessionColumns + ` FROM Sessions WHERE user_id = ? AND expiration_date > ?
+		ORDER BY last_seen DESC, session_id DESC`
+	rows, err := m.DB.Query(stmt, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession ends one session of a user. It returns ErrNoRecord when the
+// user has no session with that ID.
+func (m *SessionModel) DeleteSession(userID, id int) error {
+	result, err := m.DB.Exec(`DELETE FROM Sessions WHERE user_id = ? AND session_id = ?`, userID, id)
 	if err != nil {
 		return err
 	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
 	return nil
 }
 
-func (m *Model) DeleteExpiredSessions() error {
-	_, err := m.DB.Exec("DELETE FROM Sessions WHERE expiration_date < $1", time.Now())
+// DeleteOtherSessions ends every session of a user but keepID.
+func (m *SessionModel) DeleteOtherSessions(userID, keepID int) error {
+	_, err := m.DB.Exec(`DELETE FROM Sessions WHERE user_id = ? AND session_id <> ?`, userID, keepID)
+	return err
+}
+
+func (m *SessionModel) DeleteSessionByUserId(userId int) error {
+	_, err := m.DB.Exec("DELETE FROM Sessions WHERE user_id = ?", userId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// DeleteExpiredSessions removes the sessions that ran out and returns how
+// many there were.
+func (m *SessionModel) DeleteExpiredSessions() (int, error) {
+	result, err := m.DB.Exec("DELETE FROM Sessions WHERE expiration_date < ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"dyelesho/forum/internal/dbs"
+)
+
+// The interfaces below describe everything the handlers need from storage.
+// The SQL models in this package satisfy them for both SQLite and
+// PostgreSQL; package memory provides in-process versions.
+
+type PostStore interface {
+	Insert(title string, content string, categoryIDs []int, userName string) (int, error)
+	Get(id int) (*Post, error)
+	Update(id int, title string, content string, categoryIDs []int) error
+	Delete(id int) error
+	GetRevisions(postID int) ([]PostRevision, error)
+	Latest(p Pagination) (*PostPage, error)
+	ByCategory(category string, p Pagination) (*PostPage, error)
+	GetPostsByUser(name string, p Pagination) (*PostPage, error)
+	GetPostsByUserReaction(userID int, p Pagination) (*PostPage, error)
+	Filter(f PostFilter, p Pagination) (*PostPage, error)
+	RepairCounters() (int, error)
+}
+
+type CategoryStore interface {
+	All() ([]Category, error)
+	Insert(name string) (int, error)
+	Delete(id int) error
+}
+
+type SearchStore interface {
+	Search(q SearchQuery) (*SearchPage, error)
+}
+
+type AttachmentStore interface {
+	Insert(a Attachment) (int, error)
+	Get(id int) (*Attachment, error)
+	ForPost(postID int) ([]Attachment, error)
+	Keys() (map[string]bool, error)
+}
+
+type CommentStore interface {
+	GetComments(postID int, viewerID int) ([]Comment, error)
+	GetCommentTree(postID int, maxDepth int, viewerID int) ([]*Comment, error)
+	PostComment(CommentInput Comment) error
+	GetComment(id int) (*Comment, error)
+	UpdateComment(id int, content string) error
+	DeleteComment(id int) error
+}
+
+type UserStore interface {
+	Insert(name, email, password string) error
+	Authenticate(email, password string) (int, error)
+	GetUserNameByEmail(email string) (string, error)
+	Get(id int) (*User, error)
+	All() ([]User, error)
+	SetRole(email, role string) (int, error)
+}
+
+type SessionStore interface {
+	CreateSession(session *Session) error
+	GetSessionFromToken(token string) (*Session, error)
+	RenewSession(session *Session) error
+	UserSessions(userID int) ([]Session, error)
+	DeleteSession(userID, id int) error
+	DeleteOtherSessions(userID, keepID int) error
+	DeleteSessionByUserId(userId int) error
+	DeleteExpiredSessions() (int, error)
+}
+
+type ReactionStore interface {
+	ReactToPost(userID, postID int, kind string) error
+	ReactToComment(userID, commentID int, kind string) error
+	PostReactions(userID, postID int) (*ReactionSummary, error)
+	CommentReactions(userID, commentID int) (*ReactionSummary, error)
+	PostReactors(postID int) ([]Reactor, error)
+	CommentReactors(commentID int) ([]Reactor, error)
+}
+
+// Stores bundles one implementation of every store the application uses.
+type Stores struct {
+	Posts       PostStore
+	Categories  CategoryStore
+	Search      SearchStore
+	Attachments AttachmentStore
+	Comments    CommentStore
+	Users       UserStore
+	Sessions    SessionStore
+	Reactions   ReactionStore
+}
+
+// NewStores returns the SQL-backed stores for db.
+func NewStores(db *dbs.DB) Stores {
+	posts := &Model{DB: db}
+	return Stores{
+		Posts:       posts,
+		Categories:  &CategoryModel{DB: db},
+		Search:      &SearchModel{DB: db},
+		Attachments: &AttachmentModel{DB: db},
+		Comments:    posts,
+		Users:       &UserModel{DB: db},
+		Sessions:    &SessionModel{DB: db},
+		Reactions:   &ReactionModel{DB: db},
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dyelesho/forum/internal/dbs"
+	"dyelesho/forum/internal/migrations"
+)
+
+// newTestDB returns a fully migrated SQLite database in a temporary
+// directory.
+func newTestDB(t *testing.T) *dbs.DB {
+	t.Helper()
+	db := openTestDB(t)
+	migrateTestDB(t, db, 0)
+	return db
+}
+
+// openTestDB returns an empty SQLite database in a temporary directory.
+func openTestDB(t *testing.T) *dbs.DB {
+	t.Helper()
+	cfg := dbs.DefaultConfig()
+	cfg.DSN = filepath.Join(t.TempDir(), "test.db")
+	db, err := dbs.OpenDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// migrateTestDB applies the migrations up to and including version, or all
+// of them when version is zero.
+func migrateTestDB(t *testing.T, db *dbs.DB, version int) {
+	t.Helper()
+	var list []migrations.Migration
+	for _, mig := range migrations.For(db.Dialect) {
+		if version == 0 || mig.Version <= version {
+			list = append(list, mig)
+		}
+	}
+	m := &migrations.Migrator{DB: db, Migrations: list}
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// postgresDSNEnv names the variable with a PostgreSQL connection string for
+// the tests that need a server. They are skipped when it is unset.
+const postgresDSNEnv = "FORUM_TEST_POSTGRES_DSN"
+
+// newPostgresTestDB returns a fully migrated PostgreSQL database. Each test
+// gets a schema of its own, which is dropped when the test ends.
+func newPostgresTestDB(t *testing.T) *dbs.DB {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	cfg := dbs.DefaultConfig()
+	cfg.Driver = dbs.Postgres
+	cfg.DSN = dsn
+	admin, err := dbs.OpenDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("forum_test_%d", time.Now().UnixNano())
+	if _, err = admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Error(err)
+		}
+		admin.Close()
+	})
+
+	cfg.DSN = withSearchPath(dsn, schema)
+	db, err := dbs.OpenDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrateTestDB(t, db, 0)
+	return db
+}
+
+// withSearchPath adds search_path to a connection string in either of the
+// forms lib/pq accepts. The driver passes it on as a run-time parameter.
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
@@ -0,0 +1,38 @@
+package models
+
+// BuildCommentTree nests a flat list of comments, ordered by id, under the
+// comments they reply to. Top-level comments have depth zero. Replies that
+// would sit deeper than maxDepth are shown as siblings at maxDepth instead;
+// a maxDepth of zero or less means no limit. Comments whose parent is missing
+// from the list are treated as top-level ones.
+func BuildCommentTree(comments []Comment, maxDepth int) []*Comment {
+	roots := []*Comment{}
+	nodes := make(map[int]*Comment, len(comments))
+	depth := make(map[int]int, len(comments))
+	// container is the comment whose Replies a node was attached to, or nil
+	// for top-level comments.
+	container := make(map[int]*Comment, len(comments))
+
+	for i := range comments {
+		c := comments[i]
+		c.Replies = nil
+		node := &c
+		nodes[c.Id] = node
+
+		parent, ok := nodes[c.ParentID]
+		if c.ParentID == 0 || !ok {
+			roots = append(roots, node)
+			continue
+		}
+
+		if maxDepth > 0 && depth[parent.Id] >= maxDepth {
+			depth[c.Id] = depth[parent.Id]
+			parent = container[parent.Id]
+		} else {
+			depth[c.Id] = depth[parent.Id] + 1
+		}
+		container[c.Id] = parent
+		parent.Replies = append(parent.Replies, node)
+	}
+	return roots
+}
@@ -5,19 +5,27 @@ import (
 	"errors"
 	"time"
 
+	"dyelesho/forum/internal/dbs"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Roles a user can hold. Admins manage the category list.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID             int
 	Name           string
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Role           string
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB *dbs.DB
 }
 
 func (m *UserModel) Duplicates(u User) error {
@@ -49,8 +57,8 @@ func (m *UserModel) Insert(name, email, password string) error {
 	}
 
 	stmt := `INSERT INTO users (name, email, hashed_password, created)
-		VALUES(?, ?, ?, datetime('now'))`
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+		VALUES(?, ?, ?, ?)`
+	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword), time.Now().UTC())
 	if err != nil {
 		return err
 	}
@@ -93,3 +101,50 @@ func (u *UserModel) GetUserNameByEmail(email string) (string, error) {
 
 	return name, nil
 }
+
+func (m *UserModel) Get(id int) (*User, error) {
+	stmt := `SELECT id, name, email, created, role FROM users WHERE id = ?`
+
+	u := &User{}
+	err := m.DB.QueryRow(stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// All returns every registered user, oldest first.
+func (m *UserModel) All() ([]User, error) {
+	rows, err := m.DB.Query(`SELECT id, name, email, created, role FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetRole changes the role of the user registered with email and returns
+// the user's ID.
+func (m *UserModel) SetRole(email, role string) (int, error) {
+	var id int
+	err := m.DB.QueryRow(`UPDATE users SET role = ? WHERE email = ? RETURNING id`, role, email).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	return id, nil
+}
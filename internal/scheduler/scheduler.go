@@ -0,0 +1,146 @@
+// Package scheduler runs housekeeping jobs in the background, each at its
+// own fixed interval, and remembers how their last run went.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job is a task that runs every Interval. Run returns a short report of
+// what it did, such as "removed 3 sessions", which is logged and shown on
+// the status page. It should give up when ctx is cancelled.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Status describes a job and its most recent run. LastRun is zero until the
+// job has finished once.
+type Status struct {
+	Name     string
+	Interval time.Duration
+	Running  bool
+	LastRun  time.Time
+	Duration time.Duration
+	Report   string
+	Err      error
+	NextRun  time.Time
+}
+
+// Scheduler runs a set of jobs until its context is cancelled. Jobs are
+// added before Start.
+type Scheduler struct {
+	infoLog  *log.Logger
+	errorLog *log.Logger
+
+	mu     sync.Mutex
+	jobs   []Job
+	status map[string]*Status
+	wg     sync.WaitGroup
+}
+
+func New(infoLog, errorLog *log.Logger) *Scheduler {
+	return &Scheduler{
+		infoLog:  infoLog,
+		errorLog: errorLog,
+		status:   map[string]*Status{},
+	}
+}
+
+// Add registers job. Jobs without a positive interval are left out, which
+// lets a flag switch a job off.
+func (s *Scheduler) Add(job Job) {
+	if job.Interval <= 0 {
+		s.infoLog.Printf("Job %s is disabled", job.Name)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+	s.status[job.Name] = &Status{Name: job.Name, Interval: job.Interval}
+}
+
+// Start runs every job once per interval, the first time one interval from
+// now, until ctx is cancelled. It does not block; see Wait.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		s.status[job.Name].NextRun = time.Now().Add(job.Interval)
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Wait blocks until every job has stopped after the context given to Start
+// was cancelled, letting runs in progress finish.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.run(ctx, job)
+		}
+	}
+}
+
+// run runs job once and records the outcome. A panicking job is reported
+// as failed rather than taking the server down.
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	s.mu.Lock()
+	s.status[job.Name].Running = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	report, err := func() (report string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return job.Run(ctx)
+	}()
+	took := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		s.errorLog.Printf("Job %s failed after %s: %v", job.Name, took, err)
+	} else {
+		s.infoLog.Printf("Job %s finished in %s: %s", job.Name, took, report)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status[job.Name]
+	status.Running = false
+	status.LastRun = start
+	status.Duration = took
+	status.Report = report
+	status.Err = err
+	status.NextRun = time.Now().Add(job.Interval)
+}
+
+// Status returns the state of every job, sorted by name.
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Status, 0, len(s.status))
+	for _, status := range s.status {
+		list = append(list, *status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestScheduler() *Scheduler {
+	discard := log.New(io.Discard, "", 0)
+	return New(discard, discard)
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func statusOf(s *Scheduler, name string) Status {
+	for _, status := range s.Status() {
+		if status.Name == name {
+			return status
+		}
+	}
+	return Status{}
+}
+
+func TestStopOnCancel(t *testing.T) {
+	s := newTestScheduler()
+	var runs int32
+	s.Add(Job{Name: "tick", Interval: time.Millisecond, Run: func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&runs, 1)
+		return "", nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	waitFor(t, "two runs", func() bool { return atomic.LoadInt32(&runs) >= 2 })
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the context was cancelled")
+	}
+
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(10 * time.Millisecond)
+	if m := atomic.LoadInt32(&runs); m != n {
+		t.Errorf("the job ran %d more times after Wait returned", m-n)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := newTestScheduler()
+	fail := errors.New("disk full")
+	ok := Job{Name: "ok", Interval: time.Hour, Run: func(ctx context.Context) (string, error) {
+		return "removed 3 sessions", nil
+	}}
+	failing := Job{Name: "failing", Interval: time.Hour, Run: func(ctx context.Context) (string, error) {
+		return "deleted 1 file", fail
+	}}
+	s.Add(ok)
+	s.Add(failing)
+
+	if list := s.Status(); len(list) != 2 || list[0].Name != "failing" || list[1].Name != "ok" {
+		t.Fatalf("Status() = %+v, want both jobs sorted by name", list)
+	}
+	if status := statusOf(s, "ok"); !status.LastRun.IsZero() {
+		t.Errorf("LastRun = %v before the first run", status.LastRun)
+	}
+
+	before := time.Now()
+	s.run(context.Background(), ok)
+	s.run(context.Background(), failing)
+
+	status := statusOf(s, "ok")
+	if status.LastRun.Before(before) || status.Report != "removed 3 sessions" || status.Err != nil || status.Running {
+		t.Errorf("ok: status = %+v", status)
+	}
+	if !status.NextRun.After(before.Add(59 * time.Minute)) {
+		t.Errorf("ok: next run at %v, want an interval from now", status.NextRun)
+	}
+	status = statusOf(s, "failing")
+	if status.LastRun.Before(before) || status.Report != "deleted 1 file" || !errors.Is(status.Err, fail) {
+		t.Errorf("failing: status = %+v", status)
+	}
+
+	// A later success clears the error.
+	failing.Run = ok.Run
+	s.run(context.Background(), failing)
+	if status = statusOf(s, "failing"); status.Err != nil {
+		t.Errorf("failing: error %v kept after a successful run", status.Err)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var errorLog bytes.Buffer
+	s := New(log.New(io.Discard, "", 0), log.New(&errorLog, "", 0))
+	var runs int32
+	s.Add(Job{Name: "panics", Interval: time.Millisecond, Run: func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&runs, 1)
+		panic("boom")
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	// The job keeps being scheduled after it panicked.
+	waitFor(t, "two runs", func() bool { return atomic.LoadInt32(&runs) >= 2 })
+	cancel()
+	s.Wait()
+
+	status := statusOf(s, "panics")
+	if status.Err == nil || !strings.Contains(status.Err.Error(), "boom") || status.Running {
+		t.Errorf("status = %+v, want the panic recorded as an error", status)
+	}
+	if !strings.Contains(errorLog.String(), "Job panics failed") {
+		t.Errorf("error log = %q", errorLog.String())
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var infoLog bytes.Buffer
+	s := New(log.New(&infoLog, "", 0), log.New(io.Discard, "", 0))
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		s.Add(Job{Name: "off", Interval: interval, Run: func(ctx context.Context) (string, error) {
+			t.Error("a disabled job ran")
+			return "", nil
+		}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	cancel()
+	s.Wait()
+
+	if list := s.Status(); len(list) != 0 {
+		t.Errorf("Status() = %+v, want no jobs", list)
+	}
+	if !strings.Contains(infoLog.String(), "Job off is disabled") {
+		t.Errorf("info log = %q", infoLog.String())
+	}
+}
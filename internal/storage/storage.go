@@ -0,0 +1,51 @@
+// Package storage keeps uploaded files. Files are addressed by keys the
+// application generates; the original file names are stored in the
+// database.
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: file not found")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Store is implemented by Disk and Memory.
+type Store interface {
+	// Put saves the contents of r under key, replacing any existing file.
+	Put(key string, r io.Reader) error
+	// Open returns the file stored under key or ErrNotFound.
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key. Deleting a missing file is
+	// not an error.
+	Delete(key string) error
+	// List returns every stored key.
+	List() ([]string, error)
+}
+
+// Keys may only use characters that are safe in any file system, which
+// also rules out path separators.
+var keyRX = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+func validKey(key string) bool {
+	return keyRX.MatchString(key)
+}
+
+// NewKey returns a random key with the given extension, such as ".png".
+func NewKey(ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(b) + ext
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return key, nil
+}
@@ -5,4 +5,102 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+// csrfToken returns the token unsafe requests have to carry, see the
+// csrf-token meta tag in base.html.
+function csrfToken() {
+	var meta = document.querySelector("meta[name='csrf-token']");
+	return meta ? meta.content : "";
+}
+
+// Markdown preview for the post and comment forms. The button toggles
+// between the rendered text and the textarea.
+var previewButtons = document.querySelectorAll(".preview-button");
+for (var i = 0; i < previewButtons.length; i++) {
+	previewButtons[i].addEventListener("click", function (event) {
+		var button = event.currentTarget;
+		var textarea = button.form.querySelector("textarea");
+		var preview = button.nextElementSibling;
+
+		if (!preview.hidden) {
+			preview.hidden = true;
+			textarea.hidden = false;
+			button.textContent = "Preview";
+			return;
+		}
+
+		var body = new URLSearchParams();
+		body.append("text", textarea.value);
+		fetch("/preview", {
+			method: "POST",
+			body: body,
+			headers: { "X-CSRF-Token": csrfToken() },
+			credentials: "same-origin"
+		})
+			.then(function (response) {
+				if (!response.ok) {
+					throw new Error(response.statusText);
+				}
+				return response.text();
+			})
+			.then(function (html) {
+				preview.innerHTML = html;
+				preview.hidden = false;
+				textarea.hidden = true;
+				button.textContent = "Edit";
+			})
+			.catch(function () {
+				preview.textContent = "The preview is not available right now.";
+				preview.hidden = false;
+			});
+	});
+}
+
+// Reactions are plain forms that reload the post. With scripts they are
+// sent in the background and only the counts are updated.
+var reactionForms = document.querySelectorAll(".reaction-form");
+for (var i = 0; i < reactionForms.length; i++) {
+	reactionForms[i].addEventListener("submit", function (event) {
+		event.preventDefault();
+		var form = event.currentTarget;
+		var reactions = form.closest(".reactions");
+
+		// Reacting twice takes the reaction back, so the form is only sent
+		// again when the request never got through. When the server did
+		// answer, reloading shows what it made of the request.
+		fetch(form.action, {
+			method: "POST",
+			body: new URLSearchParams(new FormData(form)),
+			headers: { "Accept": "application/json", "X-CSRF-Token": csrfToken() },
+			credentials: "same-origin"
+		})
+			.then(function (response) {
+				// A redirect means the session ran out and the login page
+				// came back instead.
+				if (response.redirected) {
+					window.location = response.url;
+					return;
+				}
+				if (!response.ok) {
+					throw new Error(response.statusText);
+				}
+				return response.json().then(function (summary) {
+					var counts = reactions.querySelectorAll("[data-count]");
+					for (var j = 0; j < counts.length; j++) {
+						counts[j].textContent = summary.counts[counts[j].dataset.count] || 0;
+					}
+					var buttons = reactions.querySelectorAll(".reaction");
+					for (var j = 0; j < buttons.length; j++) {
+						var active = buttons[j].dataset.kind == summary.reaction;
+						buttons[j].classList.toggle("active", active);
+						buttons[j].setAttribute("aria-pressed", active);
+					}
+				});
+			}, function () {
+				form.submit();
+			})
+			.catch(function () {
+				window.location.reload();
+			});
+	});
+}